@@ -0,0 +1,92 @@
+package raftsqlite3
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// aliasPattern matches the schema names accepted by Attach.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Attach attaches the database file at path under the schema name alias, e.g.
+// another store to compare logs with. The attached tables are queried through
+// DB() by qualifying them with alias:
+//
+//	select a.id from logs a left join other.logs b on a.id = b.id where b.id is null
+//
+// Since an attached database belongs to a single connection, the store is
+// pinned to one connection until the last alias is detached. Meanwhile a read
+// of the store made while another one holds the connection blocks forever,
+// e.g. a read from a callback of IterateLogs or StreamLogs, or a Diff of the
+// store against itself. Reads made on their own connections with
+// WithReadBusyTimeout don't see the attached database.
+func (s *Sqlite3Store) Attach(path, alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("invalid alias %q", alias)
+	}
+
+	s.amu.Lock()
+	defer s.amu.Unlock()
+	if len(s.attached) == 0 {
+		s.maxOpenConns = s.db.Stats().MaxOpenConnections
+		s.pinConnection()
+	}
+	query := fmt.Sprintf("attach database ? as %s", alias)
+	if _, err := s.db.Exec(query, path); err != nil {
+		if len(s.attached) == 0 {
+			s.unpinConnection()
+		}
+		return err
+	}
+	if s.attached == nil {
+		s.attached = make(map[string]bool)
+	}
+	s.attached[alias] = true
+	return nil
+}
+
+// Detach detaches the database attached under alias. Once the last alias is
+// detached, the pool of the store gets back the max number of open
+// connections it had before Attach, and the default max of idle ones.
+func (s *Sqlite3Store) Detach(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("invalid alias %q", alias)
+	}
+
+	s.amu.Lock()
+	defer s.amu.Unlock()
+	query := fmt.Sprintf("detach database %s", alias)
+	if _, err := s.db.Exec(query); err != nil {
+		return err
+	}
+	delete(s.attached, alias)
+	if len(s.attached) == 0 {
+		s.unpinConnection()
+	}
+	return nil
+}
+
+// pinConnection limits the pool of the store to a single connection that is
+// kept open, for the state that sqlite3 keeps per connection. The idle
+// connections are closed first, and the ones in use are closed once released,
+// so that no connection opened before is handed out again.
+func (s *Sqlite3Store) pinConnection() {
+	s.db.SetMaxIdleConns(0)
+	s.db.SetMaxOpenConns(1)
+	s.db.SetMaxIdleConns(1)
+	s.db.SetConnMaxLifetime(0)
+}
+
+// defaultMaxIdleConns is the max number of idle connections database/sql
+// keeps by default.
+const defaultMaxIdleConns = 2
+
+// unpinConnection restores the pool limits saved by Attach, unless the store
+// is pinned for an in-memory image.
+func (s *Sqlite3Store) unpinConnection() {
+	if s.opts.image != nil {
+		return
+	}
+	s.db.SetMaxOpenConns(s.maxOpenConns)
+	s.db.SetMaxIdleConns(defaultMaxIdleConns)
+}
@@ -0,0 +1,165 @@
+package raftsqlite3
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestSqlite3Store_Attach(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+	other, otherPath := testSqlite3Store(t)
+	defer other.Close()
+	defer os.Remove(otherPath)
+
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+		testRaftLog(3, "log3"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := other.StoreLogs(logs[:2]); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := store.Attach(otherPath, "other"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The attached database stays visible across queries
+	query := "select a.id from logs a left join other.logs b on a.id = b.id where b.id is null"
+	for i := 0; i < 3; i++ {
+		var missing uint64
+		if err := store.DB().QueryRow(query).Scan(&missing); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if missing != 3 {
+			t.Fatalf("bad: %d", missing)
+		}
+	}
+
+	// The store keeps working while attached
+	if err := store.StoreLog(testRaftLog(4, "log4")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := store.Detach("other"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := store.DB().Exec("select count(*) from other.logs"); err == nil {
+		t.Fatalf("expected error after detach")
+	}
+
+	if err := store.Attach(otherPath, "other; drop table logs"); err == nil {
+		t.Fatalf("expected invalid alias error")
+	}
+}
+
+func TestSqlite3Store_Attach_OpenConns(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+	other, otherPath := testSqlite3Store(t)
+	defer other.Close()
+	defer os.Remove(otherPath)
+
+	if err := other.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Fill the pool with several connections before attaching
+	ctx := context.Background()
+	conns := make([]*sql.Conn, 4)
+	for i := range conns {
+		conn, err := store.DB().Conn(ctx)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := conn.ExecContext(ctx, "select 1"); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		conns[i] = conn
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	if err := store.Attach(otherPath, "other"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Every connection handed out sees the attached database
+	for i := 0; i < 8; i++ {
+		conn, err := store.DB().Conn(ctx)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var n int
+		err = conn.QueryRowContext(ctx, "select count(*) from other.logs").Scan(&n)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if n != 1 {
+			t.Fatalf("bad: %d", n)
+		}
+	}
+}
+
+func TestSqlite3Store_Detach_Unpin(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+	other, otherPath := testSqlite3Store(t)
+	defer other.Close()
+	defer os.Remove(otherPath)
+
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Attach(otherPath, "other"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Attach(otherPath, "again"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := store.DB().Stats().MaxOpenConnections; n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+	if err := store.Detach("other"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := store.DB().Stats().MaxOpenConnections; n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// The last Detach restores the pool, so that nested reads proceed
+	if err := store.Detach("again"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n := store.DB().Stats().MaxOpenConnections; n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- store.IterateLogs(1, 2, func(log *raft.Log) error {
+			return store.GetLog(log.Index, new(raft.Log))
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("nested read blocked")
+	}
+}
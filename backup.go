@@ -0,0 +1,131 @@
+package raftsqlite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backup copies the database into the file at path with the online backup
+// API, which reads a consistent snapshot while the store keeps serving. An
+// existing file at path is overwritten.
+func (s *Sqlite3Store) Backup(path string) error {
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	return copyDatabase(dest, s.db)
+}
+
+// preDestructiveBackup backs the store up into a timestamped file of the
+// WithPreDestructiveBackup directory before the destructive method, and
+// returns the backup path, "" without the option.
+func (s *Sqlite3Store) preDestructiveBackup(method string) (string, error) {
+	dir := s.opts.preDestructiveBackupDir
+	if dir == "" {
+		return "", nil
+	}
+	name := fmt.Sprintf("%s-%s.db", strings.ToLower(method), time.Now().UTC().Format("20060102T150405.000000000"))
+	path := filepath.Join(dir, name)
+	if err := s.Backup(path); err != nil {
+		return "", fmt.Errorf("backup before %s: %w", method, err)
+	}
+	s.logger.Printf("[INFO ] %s: backup before %s into %s", tag, method, path)
+	return path, nil
+}
+
+// RestoreFrom copies the database file at srcPath, e.g. written by Backup,
+// into the store with the online backup API, then checks the integrity of
+// the result. The store must hold no log, else it returns ErrNotEmpty.
+func (s *Sqlite3Store) RestoreFrom(srcPath string) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	empty, err := s.IsEmpty()
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return ErrNotEmpty
+	}
+	// Opening a missing file would create it
+	if _, err := os.Stat(srcPath); err != nil {
+		return err
+	}
+	src, err := sql.Open("sqlite3", srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := copyDatabase(s.db, src); err != nil {
+		return err
+	}
+	if err := integrityCheck(s.db); err != nil {
+		return err
+	}
+	// The backup may come from a store of other schema options
+	if err := s.checkSplitData(); err != nil {
+		return err
+	}
+	return s.checkLogKeyType()
+}
+
+// copyDatabase copies the main database of src into the one of dest.
+func copyDatabase(dest, src *sql.DB) error {
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDC interface{}) error {
+		return srcConn.Raw(func(srcDC interface{}) error {
+			b, err := destDC.(*sqlite3.SQLiteConn).Backup("main", srcDC.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			done, err := b.Step(-1)
+			if err != nil {
+				b.Finish()
+				return err
+			}
+			if !done {
+				b.Finish()
+				return fmt.Errorf("backup incomplete, %d pages remaining", b.Remaining())
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// integrityCheck runs the integrity_check pragma, and returns its findings
+// as an error unless it reports ok.
+func integrityCheck(db *sql.DB) error {
+	var result string
+	if err := db.QueryRow("pragma integrity_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check: %s", result)
+	}
+	return nil
+}
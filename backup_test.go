@@ -0,0 +1,115 @@
+package raftsqlite3
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_Backup_RestoreFrom(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("term"), 3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	backup := path + ".bak"
+	defer os.Remove(backup)
+	if err := store.Backup(backup); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A store holding logs isn't overwritten
+	if err := store.RestoreFrom(backup); err != raftsqlite3.ErrNotEmpty {
+		t.Fatalf("expected not empty error, got: %v", err)
+	}
+
+	restored, path2 := testSqlite3Store(t)
+	defer restored.Close()
+	defer os.Remove(path2)
+	if err := restored.RestoreFrom(path2 + ".missing"); err == nil {
+		t.Fatalf("should fail on a missing file")
+	}
+	if err := restored.RestoreFrom(backup); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, expected := range logs {
+		result := new(raft.Log)
+		if err := restored.GetLog(expected.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+	if v, err := restored.GetUint64([]byte("term")); err != nil || v != 3 {
+		t.Fatalf("bad: %d, %v", v, err)
+	}
+
+	// The restored store goes on
+	if err := restored.StoreLog(testRaftLog(3, "log3")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSqlite3Store_PreDestructiveBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raftsqlite3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store, path := testSqlite3Store(t, raftsqlite3.WithPreDestructiveBackup(dir))
+	defer store.Close()
+	defer os.Remove(path)
+
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	backup, err := store.DeleteAll()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if filepath.Dir(backup) != dir {
+		t.Fatalf("bad: %s", backup)
+	}
+	if empty, err := store.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+	backed, err := raftsqlite3.New(backup)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer backed.Close()
+	if last, err := backed.LastIndex(); err != nil || last != 2 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+
+	if backup, err = store.Vacuum(); err != nil || filepath.Dir(backup) != dir {
+		t.Fatalf("bad: %s, %v", backup, err)
+	}
+
+	// A failed backup aborts
+	failing, path2 := testSqlite3Store(t, raftsqlite3.WithPreDestructiveBackup(filepath.Join(dir, "missing")))
+	defer failing.Close()
+	defer os.Remove(path2)
+	if err := failing.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := failing.DeleteAll(); err == nil {
+		t.Fatalf("should fail to backup")
+	}
+	if last, err := failing.LastIndex(); err != nil || last != 2 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+}
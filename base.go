@@ -0,0 +1,170 @@
+package raftsqlite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// keyBaseIndex is the conf key of the base index.
+var keyBaseIndex = []byte("raftsqlite3.base_index")
+
+// BaseIndex returns the base index of the log, that is the last index
+// compacted away by deleting from the head of the log, or 0 if the log was
+// never compacted.
+func (s *Sqlite3Store) BaseIndex() (uint64, error) {
+	return getBaseIndex(s.reader())
+}
+
+// queryRower is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func getBaseIndex(q queryRower) (uint64, error) {
+	query := fmt.Sprintf("select value from %s where id = ?", dbConf)
+	var val []byte
+	err := q.QueryRow(query, keyBaseIndex).Scan(&val)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return bytesToUint64(val), nil
+}
+
+// compactBase raises the base index to max within tx, after the logs up to
+// max were deleted in it, if the deletion compacted the head of the log: no
+// log is left at or below max, and logs are left above it. Deleting the whole
+// log, e.g. to drop conflicting logs or to restore a snapshot, isn't a
+// compaction, so that the same indexes can be stored again.
+func (s *Sqlite3Store) compactBase(ctx context.Context, tx *sql.Tx, max uint64) error {
+	var below, above bool
+	query := fmt.Sprintf("select exists(select 1 from %s where id >= ? and id <= ?),"+
+		" exists(select 1 from %s where id > ?)", dbLogs, dbLogs)
+	err := tx.QueryRowContext(ctx, query, s.logKey(1), s.logKey(max), s.logKey(max)).Scan(&below, &above)
+	if err != nil {
+		return err
+	}
+	if below || !above {
+		return nil
+	}
+
+	base, err := getBaseIndex(tx)
+	if err != nil {
+		return err
+	}
+	if max <= base {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, s.setConfQuery(), keyBaseIndex, uint64ToBytes(max))
+	return err
+}
+
+// checkAboveBase returns ErrBelowBase if any of the logs is at or below the
+// base index.
+func checkAboveBase(tx *sql.Tx, logs []*raft.Log) error {
+	base, err := getBaseIndex(tx)
+	if err != nil {
+		return err
+	}
+	for _, log := range logs {
+		if log.Index <= base {
+			return fmt.Errorf("%w: index %d, base %d", ErrBelowBase, log.Index, base)
+		}
+	}
+	return nil
+}
+
+// keySnapshotMarker is the conf key of the index and term of the last
+// snapshot installed by InstallSnapshotMarker.
+var keySnapshotMarker = []byte("raftsqlite3.snapshot_marker")
+
+// InstallSnapshotMarker records a snapshot up to index at term: in one
+// transaction, it deletes the logs up to index, raises the base index to
+// index, and records index and term as the snapshot marker, so that the
+// compaction and the marker can't disagree after a crash.
+func (s *Sqlite3Store) InstallSnapshotMarker(index, term uint64) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+
+	start := time.Now()
+	for retries := 0; ; retries++ {
+		if err := s.doInstallSnapshotMarker(index, term); err != nil {
+			if s.waitIfBusy("InstallSnapshotMarker()", err, 100*time.Millisecond, start, retries) {
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+func (s *Sqlite3Store) doInstallSnapshotMarker(index, term uint64) (err error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	ctx, cancel := s.opContext()
+	defer cancel()
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := fmt.Sprintf("delete from %s where id <= ?", dbLogs)
+	if _, err = tx.ExecContext(ctx, query, s.logKey(index)); err != nil {
+		return timeoutError(ctx, err)
+	}
+	if s.opts.splitData {
+		query = fmt.Sprintf("delete from %s where id <= ?", dbLogData)
+		if _, err = tx.ExecContext(ctx, query, s.logKey(index)); err != nil {
+			return timeoutError(ctx, err)
+		}
+	}
+	base, err := getBaseIndex(tx)
+	if err != nil {
+		return err
+	}
+	query = s.setConfQuery()
+	if index > base {
+		if _, err = tx.ExecContext(ctx, query, keyBaseIndex, uint64ToBytes(index)); err != nil {
+			return timeoutError(ctx, err)
+		}
+	}
+	marker := append(uint64ToBytes(index), uint64ToBytes(term)...)
+	if _, err = tx.ExecContext(ctx, query, keySnapshotMarker, marker); err != nil {
+		return timeoutError(ctx, err)
+	}
+	return timeoutError(ctx, tx.Commit())
+}
+
+// SnapshotMarker returns the index and term of the last snapshot recorded by
+// InstallSnapshotMarker, or zeros if none was.
+func (s *Sqlite3Store) SnapshotMarker() (index, term uint64, err error) {
+	query := fmt.Sprintf("select value from %s where id = ?", dbConf)
+	var val []byte
+	ctx, cancel := s.opContext()
+	defer cancel()
+	err = s.reader().QueryRowContext(ctx, query, keySnapshotMarker).Scan(&val)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, timeoutError(ctx, err)
+	}
+	if len(val) != 16 {
+		return 0, 0, fmt.Errorf("invalid snapshot marker of %d bytes", len(val))
+	}
+	return bytesToUint64(val[:8]), bytesToUint64(val[8:]), nil
+}
@@ -0,0 +1,190 @@
+package raftsqlite3
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_BaseIndex(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Zero when never compacted
+	base, err := store.BaseIndex()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if base != 0 {
+		t.Fatalf("bad: %d", base)
+	}
+
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+		testRaftLog(3, "log3"),
+		testRaftLog(4, "log4"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Deleting the tail doesn't compact
+	if err := store.DeleteRange(4, 4); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if base, _ = store.BaseIndex(); base != 0 {
+		t.Fatalf("bad: %d", base)
+	}
+
+	// Deleting the head does
+	if err := store.DeleteRange(1, 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if base, _ = store.BaseIndex(); base != 2 {
+		t.Fatalf("bad: %d", base)
+	}
+}
+
+func TestSqlite3Store_RejectBelowBase(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithRejectBelowBase())
+	defer store.Close()
+	defer os.Remove(path)
+
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+		testRaftLog(3, "log3"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(1, 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Re-sending compacted logs is rejected as a whole
+	resend := []*raft.Log{
+		testRaftLog(2, "log2"),
+		testRaftLog(4, "log4"),
+	}
+	if err := store.StoreLogs(resend); !errors.Is(err, raftsqlite3.ErrBelowBase) {
+		t.Fatalf("expected below base error, got: %v", err)
+	}
+	if err := store.GetLog(4, new(raft.Log)); err != raft.ErrLogNotFound {
+		t.Fatalf("expected raft log not found error, got: %v", err)
+	}
+
+	// Logs above the base are stored
+	if err := store.StoreLog(testRaftLog(4, "log4")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSqlite3Store_InstallSnapshotMarker(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithSplitData())
+	defer store.Close()
+	defer os.Remove(path)
+
+	if index, term, err := store.SnapshotMarker(); err != nil || index != 0 || term != 0 {
+		t.Fatalf("bad: %d, %d, %v", index, term, err)
+	}
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := store.InstallSnapshotMarker(6, 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if index, term, err := store.SnapshotMarker(); err != nil || index != 6 || term != 2 {
+		t.Fatalf("bad: %d, %d, %v", index, term, err)
+	}
+	if base, err := store.BaseIndex(); err != nil || base != 6 {
+		t.Fatalf("bad: %d, %v", base, err)
+	}
+	if first, err := store.FirstIndex(); err != nil || first != 7 {
+		t.Fatalf("bad: %d, %v", first, err)
+	}
+	var n int
+	if err := store.DB().QueryRow("select count(*) from log_data").Scan(&n); err != nil || n != 4 {
+		t.Fatalf("bad: %d, %v", n, err)
+	}
+
+	// A snapshot past the last log empties the log
+	if err := store.InstallSnapshotMarker(20, 3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if empty, err := store.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+	if index, term, err := store.SnapshotMarker(); err != nil || index != 20 || term != 3 {
+		t.Fatalf("bad: %d, %d, %v", index, term, err)
+	}
+}
+
+func TestSqlite3Store_DeleteWholeLog(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithRejectBelowBase())
+	defer store.Close()
+	defer os.Remove(path)
+
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2"), testRaftLog(3, "log3")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Deleting [first, last] isn't a compaction
+	if err := store.DeleteRange(1, 3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if base, err := store.BaseIndex(); err != nil || base != 0 {
+		t.Fatalf("bad: %d, %v", base, err)
+	}
+
+	// The replacement logs are stored at the same indexes
+	replaced := []*raft.Log{testRaftLog(1, "new1"), testRaftLog(2, "new2"), testRaftLog(3, "new3")}
+	if err := store.StoreLogs(replaced); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	result := new(raft.Log)
+	if err := store.GetLog(2, result); err != nil || string(result.Data) != "new2" {
+		t.Fatalf("bad: %#v, %v", result, err)
+	}
+}
+
+func TestSqlite3Store_BaseIndex_Batches(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 2500; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The compaction spans several batches, decided by the last one
+	if err := store.DeleteRange(1, 2000); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if base, err := store.BaseIndex(); err != nil || base != 2000 {
+		t.Fatalf("bad: %d, %v", base, err)
+	}
+
+	// Deleting the rest isn't a compaction
+	if err := store.DeleteRange(2001, 2500); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if base, err := store.BaseIndex(); err != nil || base != 2000 {
+		t.Fatalf("bad: %d, %v", base, err)
+	}
+}
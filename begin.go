@@ -0,0 +1,77 @@
+package raftsqlite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// An error indicating the store is closed
+	ErrStoreClosed = errors.New("store closed")
+
+	// An error indicating a transaction couldn't begin in time
+	ErrBeginTimeout = errors.New("begin timed out")
+
+	// An error indicating the database file can't be read or written
+	ErrDiskIO = errors.New("disk i/o failure")
+)
+
+// beginError is a failure to begin a write transaction, classified by kind.
+// It matches kind with errors.Is and unwraps to the failure.
+type beginError struct {
+	kind error
+	err  error
+}
+
+func (e *beginError) Error() string {
+	return fmt.Sprintf("begin: %s: %s", e.kind, e.err)
+}
+
+func (e *beginError) Unwrap() error {
+	return e.err
+}
+
+func (e *beginError) Is(target error) bool {
+	return target == e.kind
+}
+
+// begin begins a write transaction. A failure to begin is classified as
+// ErrStoreClosed, ErrBeginTimeout or ErrDiskIO when it's one, so that callers
+// tell the failures to retry from the ones to give up on; the busy errors are
+// returned as is, to be retried.
+func (s *Sqlite3Store) begin() (*sql.Tx, error) {
+	return s.beginTx(context.Background())
+}
+
+// beginTx is like begin, the transaction being bound to ctx.
+func (s *Sqlite3Store) beginTx(ctx context.Context) (*sql.Tx, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, classifyBeginError(err)
+	}
+	return tx, nil
+}
+
+// classifyBeginError wraps err into a beginError of its kind, or returns it
+// as is if it has none.
+func classifyBeginError(err error) error {
+	var kind error
+	var e sqlite3.Error
+	switch {
+	case errors.Is(err, sql.ErrConnDone) || strings.Contains(err.Error(), "database is closed"):
+		kind = ErrStoreClosed
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		kind = ErrBeginTimeout
+	case errors.As(err, &e) && (e.Code == sqlite3.ErrIoErr || e.Code == sqlite3.ErrFull ||
+		e.Code == sqlite3.ErrCantOpen || e.Code == sqlite3.ErrCorrupt || e.Code == sqlite3.ErrNotADB):
+		kind = ErrDiskIO
+	default:
+		return err
+	}
+	return &beginError{kind: kind, err: err}
+}
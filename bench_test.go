@@ -1,31 +1,20 @@
 package raftsqlite3
 
 import (
-	"io/ioutil"
+	"fmt"
+	"math/rand"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/raft"
 	"github.com/hashicorp/raft/bench"
 	"github.com/little-pan/raft-sqlite3"
 )
 
-func testSqlite3Store(t testing.TB) (*raftsqlite3.Sqlite3Store, string) {
-	fh, err := ioutil.TempFile("", "sqlite3.db")
-	if err != nil {
-		t.Fatalf("err: %s", err)
-	}
-	os.Remove(fh.Name())
-	
-	// Successfully creates and returns a store
-	path := fh.Name()
-	store, err := raftsqlite3.NewSqlite3Store(path)
-	if err != nil {
-		t.Fatalf("err: %s", err)
-	}
-
-	return store, path
-}
-
 func BenchmarkSqlite3Store_FirstIndex(b *testing.B) {
 	store, path := testSqlite3Store(b)
 	defer store.Close()
@@ -105,3 +94,190 @@ func BenchmarkSqlite3Store_GetUint64(b *testing.B) {
 
 	raftbench.GetUint64(b, store)
 }
+
+// benchmarkMetadata runs FirstIndex and LastIndex on a store holding logs
+// with large payloads.
+func benchmarkMetadata(b *testing.B, opts ...raftsqlite3.Option) {
+	store, path := testSqlite3Store(b, opts...)
+	defer store.Close()
+	defer os.Remove(path)
+
+	data := make([]byte, 16*1024)
+	logs := make([]*raft.Log, 0, 1000)
+	for i := 1; i <= 1000; i++ {
+		logs = append(logs, &raft.Log{Index: uint64(i), Term: 1, Data: data})
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.FirstIndex(); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+		if _, err := store.LastIndex(); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func BenchmarkSqlite3Store_Metadata(b *testing.B) {
+	benchmarkMetadata(b)
+}
+
+func BenchmarkSqlite3Store_Metadata_SplitData(b *testing.B) {
+	benchmarkMetadata(b, raftsqlite3.WithSplitData())
+}
+
+// benchmarkRangePrefix scans a namespace of 100 keys among 10000 keys.
+func benchmarkRangePrefix(b *testing.B, opts ...raftsqlite3.Option) {
+	store, path := testSqlite3Store(b, opts...)
+	defer store.Close()
+	defer os.Remove(path)
+
+	val := make([]byte, 64)
+	for i := 0; i < 10000; i++ {
+		key := []byte(fmt.Sprintf("ns%02d/%04d", i%100, i))
+		if err := store.Set(key, val); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		kvs, err := store.RangePrefix([]byte("ns42/"))
+		if err != nil {
+			b.Fatalf("err: %s", err)
+		}
+		if len(kvs) != 100 {
+			b.Fatalf("bad: %d", len(kvs))
+		}
+	}
+}
+
+func BenchmarkSqlite3Store_RangePrefix(b *testing.B) {
+	benchmarkRangePrefix(b)
+}
+
+func BenchmarkSqlite3Store_RangePrefix_ConfIndex(b *testing.B) {
+	benchmarkRangePrefix(b, raftsqlite3.WithConfIndex())
+}
+
+// benchmarkSustainedStoreLogs stores batches of 64 logs of 1KB back to back.
+func benchmarkSustainedStoreLogs(b *testing.B, opts ...raftsqlite3.Option) {
+	store, path := testSqlite3Store(b, opts...)
+	defer store.Close()
+	defer os.Remove(path)
+
+	data := make([]byte, 1024)
+	logs := make([]*raft.Log, 64)
+	b.SetBytes(int64(len(logs) * len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range logs {
+			logs[j] = &raft.Log{Index: uint64(i*len(logs) + j + 1), Term: 1, Data: data}
+		}
+		if err := store.StoreLogs(logs); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func BenchmarkSqlite3Store_SustainedStoreLogs(b *testing.B) {
+	benchmarkSustainedStoreLogs(b)
+}
+
+func BenchmarkSqlite3Store_SustainedStoreLogs_DeferredCheckpoint(b *testing.B) {
+	benchmarkSustainedStoreLogs(b, raftsqlite3.WithDeferredCheckpoint())
+}
+
+// benchmarkMixedRW runs parallel readers, each getting a log or a range of
+// 16 logs in turn, while a writer stores batches of 64 logs of 1KB. It
+// reports the p99 latency of the reads.
+func benchmarkMixedRW(b *testing.B, opts ...raftsqlite3.Option) {
+	store, path := testSqlite3Store(b, opts...)
+	defer store.Close()
+	defer os.Remove(path)
+
+	data := make([]byte, 1024)
+	var last uint64
+	store64 := func() error {
+		logs := make([]*raft.Log, 64)
+		for j := range logs {
+			logs[j] = &raft.Log{Index: last + uint64(j) + 1, Term: 1, Data: data}
+		}
+		if err := store.StoreLogs(logs); err != nil {
+			return err
+		}
+		atomic.StoreUint64(&last, last+uint64(len(logs)))
+		return nil
+	}
+	if err := store64(); err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	stop, done := make(chan struct{}), make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			default:
+			}
+			if err := store64(); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+	)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		var local []time.Duration
+		for i := 0; pb.Next(); i++ {
+			idx := uint64(rnd.Int63n(int64(atomic.LoadUint64(&last)-16))) + 1
+			start := time.Now()
+			var err error
+			if i%2 == 0 {
+				err = store.GetLog(idx, new(raft.Log))
+			} else {
+				_, err = store.GetLogRange(idx, idx+15)
+			}
+			if err != nil {
+				b.Errorf("err: %s", err)
+				return
+			}
+			local = append(local, time.Since(start))
+		}
+		mu.Lock()
+		latencies = append(latencies, local...)
+		mu.Unlock()
+	})
+	b.StopTimer()
+	close(stop)
+	if err := <-done; err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		p99 := latencies[len(latencies)*99/100]
+		b.ReportMetric(float64(p99.Nanoseconds()), "p99-ns/read")
+	}
+	b.ReportMetric(float64(atomic.LoadUint64(&last)), "logs-written")
+}
+
+func BenchmarkSqlite3Store_MixedRW(b *testing.B) {
+	benchmarkMixedRW(b)
+}
+
+func BenchmarkSqlite3Store_MixedRW_ReadBusyTimeout(b *testing.B) {
+	benchmarkMixedRW(b, raftsqlite3.WithReadBusyTimeout(10*time.Second))
+}
@@ -0,0 +1,74 @@
+// Package boltdb migrates a raft-boltdb store to a raftsqlite3 store, apart
+// from the core package to keep it free of the bolt dependency.
+package boltdb
+
+import (
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// The buckets of raft-boltdb, the logs keyed by big-endian index, and
+	// the conf.
+	bucketLogs = []byte("logs")
+	bucketConf = []byte("conf")
+)
+
+// MigrateFromBolt copies the logs and the conf of the raft-boltdb store at
+// boltPath into the store at sqlitePath, opened with opts, keeping the log
+// indexes and the conf keys. The logs are streamed by the batches of Import.
+// The bolt file is opened read-only, and the store at sqlitePath must hold no
+// logs, else raftsqlite3.ErrNotEmpty is returned.
+//
+// The logs are decoded in the msgpack format of raft-boltdb, which is the
+// one of raftsqlite3.MsgpackCodec, and stored with the codec of opts.
+func MigrateFromBolt(boltPath, sqlitePath string, opts ...raftsqlite3.Option) error {
+	db, err := bolt.Open(boltPath, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	store, err := raftsqlite3.New(sqlitePath, opts...)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	empty, err := store.IsEmpty()
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return raftsqlite3.ErrNotEmpty
+	}
+
+	return db.View(func(tx *bolt.Tx) error {
+		if logs := tx.Bucket(bucketLogs); logs != nil {
+			c := logs.Cursor()
+			k, v := c.First()
+			next := func() (*raft.Log, error) {
+				if k == nil {
+					return nil, nil
+				}
+				log := new(raft.Log)
+				if err := (raftsqlite3.MsgpackCodec{}).Decode(v, log); err != nil {
+					return nil, err
+				}
+				k, v = c.Next()
+				return log, nil
+			}
+			if _, err := store.Import(next); err != nil {
+				return err
+			}
+		}
+		if conf := tx.Bucket(bucketConf); conf != nil {
+			return conf.ForEach(func(k, v []byte) error {
+				return store.Set(k, v)
+			})
+		}
+		return nil
+	})
+}
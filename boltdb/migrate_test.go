@@ -0,0 +1,81 @@
+package boltdb
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMigrateFromBolt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "raftsqlite3")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	boltPath, sqlitePath := dir+"/raft.db", dir+"/raft.sqlite3"
+
+	// A store in the format of raft-boltdb
+	db, err := bolt.Open(boltPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var logs []*raft.Log
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(bucketLogs)
+		if err != nil {
+			return err
+		}
+		for i := uint64(1); i <= 2500; i++ {
+			log := &raft.Log{Index: i, Term: 1, Data: []byte("log")}
+			val, err := raftsqlite3.MsgpackCodec{}.Encode(log)
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, i)
+			if err := bucket.Put(key, val); err != nil {
+				return err
+			}
+			logs = append(logs, log)
+		}
+		conf, err := tx.CreateBucket(bucketConf)
+		if err != nil {
+			return err
+		}
+		return conf.Put([]byte("CurrentTerm"), []byte{0, 0, 0, 0, 0, 0, 0, 1})
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db.Close()
+
+	if err := MigrateFromBolt(boltPath, sqlitePath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err := raftsqlite3.New(sqlitePath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	result, err := store.GetLogRange(1, 2500)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, logs) {
+		t.Fatalf("bad: %d logs", len(result))
+	}
+	if term, err := store.GetUint64([]byte("CurrentTerm")); err != nil || term != 1 {
+		t.Fatalf("bad: %d, %v", term, err)
+	}
+
+	// A store holding logs isn't migrated into
+	if err := MigrateFromBolt(boltPath, sqlitePath); err != raftsqlite3.ErrNotEmpty {
+		t.Fatalf("expected not empty error, got: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package raftsqlite3
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// CheckpointMode is the mode of a WAL checkpoint, see
+// https://www.sqlite.org/pragma.html#pragma_wal_checkpoint
+type CheckpointMode int
+
+const (
+	// CheckpointPassive checkpoints as many frames as possible without
+	// waiting for readers or writers.
+	CheckpointPassive CheckpointMode = iota
+	// CheckpointFull waits for the writers, then checkpoints all frames.
+	CheckpointFull
+	// CheckpointRestart is like CheckpointFull, and also waits for the readers
+	// so that the next writer restarts the WAL from the beginning.
+	CheckpointRestart
+	// CheckpointTruncate is like CheckpointRestart, and also truncates the WAL
+	// file to zero bytes.
+	CheckpointTruncate
+)
+
+// String returns the mode name of the wal_checkpoint pragma.
+func (m CheckpointMode) String() string {
+	switch m {
+	case CheckpointPassive:
+		return "PASSIVE"
+	case CheckpointFull:
+		return "FULL"
+	case CheckpointRestart:
+		return "RESTART"
+	case CheckpointTruncate:
+		return "TRUNCATE"
+	default:
+		return fmt.Sprintf("CheckpointMode(%d)", int(m))
+	}
+}
+
+// checkpointResult is the outcome of a wal_checkpoint pragma.
+type checkpointResult struct {
+	// busy is true if the checkpoint couldn't complete.
+	busy bool
+	// logFrames is the number of frames in the WAL.
+	logFrames int
+	// checkpointed is the number of frames checkpointed.
+	checkpointed int
+}
+
+// Checkpoint checkpoints the WAL into the database in the given mode.
+func (s *Sqlite3Store) Checkpoint(mode CheckpointMode) error {
+	_, err := s.checkpoint(mode)
+	return err
+}
+
+// TruncateWAL checkpoints the whole WAL into the database, then truncates the
+// WAL file to zero bytes, e.g. at the end of a bulk Import or DeleteRange. It
+// waits up to the busy timeout for the readers of other connections to
+// finish, as the WAL can't be truncated while they read from it, and returns
+// ErrCheckpointBusy if they don't.
+func (s *Sqlite3Store) TruncateWAL() error {
+	res, err := s.checkpoint(CheckpointTruncate)
+	if err != nil {
+		return err
+	}
+	if res.busy {
+		return fmt.Errorf("%w: %d of %d WAL frames checkpointed",
+			ErrCheckpointBusy, res.checkpointed, res.logFrames)
+	}
+	return nil
+}
+
+func (s *Sqlite3Store) checkpoint(mode CheckpointMode) (checkpointResult, error) {
+	var res checkpointResult
+	switch mode {
+	case CheckpointPassive, CheckpointFull, CheckpointRestart, CheckpointTruncate:
+	default:
+		return res, fmt.Errorf("invalid checkpoint mode %d", int(mode))
+	}
+
+	// Don't fight our own writer for the lock
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	query := fmt.Sprintf("pragma wal_checkpoint(%s)", mode)
+	err := s.db.QueryRow(query).Scan(&res.busy, &res.logFrames, &res.checkpointed)
+	if err == nil && !res.busy {
+		atomic.StoreInt64(&s.lastCheckpoint, time.Now().UnixNano())
+		atomic.StoreUint64(&s.storedSinceCheckpoint, 0)
+	}
+	return res, err
+}
+
+// checkpointEveryN counts the n logs stored, and runs a full checkpoint once
+// the count since the last one reaches the one of WithCheckpointEveryN.
+func (s *Sqlite3Store) checkpointEveryN(n int) error {
+	every := s.opts.checkpointEveryN
+	if every == 0 || n == 0 {
+		return nil
+	}
+	if atomic.AddUint64(&s.storedSinceCheckpoint, uint64(n)) < every {
+		return nil
+	}
+	res, err := s.checkpoint(CheckpointFull)
+	if err != nil {
+		return err
+	}
+	if res.busy {
+		return fmt.Errorf("%w: %d of %d WAL frames checkpointed",
+			ErrCheckpointBusy, res.checkpointed, res.logFrames)
+	}
+	return nil
+}
+
+// TimeSinceCheckpoint returns the time since the last checkpoint of the store
+// that completed, or since the store was opened before any, e.g. to alert on
+// a WAL growing for lack of checkpoints. The checkpoints of Checkpoint,
+// TruncateWAL, FlushCommits, WithAutoCheckpoint and WithDeferredCheckpoint
+// count, but not the ones sqlite3 runs on commit per the wal_autocheckpoint
+// pragma, which the store doesn't see.
+func (s *Sqlite3Store) TimeSinceCheckpoint() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&s.lastCheckpoint)))
+}
+
+// autoCheckpoint checkpoints in mode every interval until the store is closed.
+func (s *Sqlite3Store) autoCheckpoint(interval time.Duration, mode CheckpointMode) {
+	defer s.bg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+		}
+
+		res, err := s.checkpoint(mode)
+		if err != nil {
+			s.logger.Printf("[WARN ] %s: auto checkpoint(%s) %s", tag, mode, err)
+			continue
+		}
+		s.logger.Printf("[DEBUG] %s: auto checkpoint(%s) busy=%t log=%d checkpointed=%d",
+			tag, mode, res.busy, res.logFrames, res.checkpointed)
+	}
+}
+
+// deferredCheckpointIdle is how long the writes of WithDeferredCheckpoint are
+// idle before the checkpoint.
+const deferredCheckpointIdle = time.Second
+
+// deferredCheckpoint truncates the WAL once no write happened for idle since
+// the last one, until the store is closed.
+func (s *Sqlite3Store) deferredCheckpoint(idle time.Duration) {
+	defer s.bg.Done()
+
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+	if !timer.Stop() {
+		<-timer.C
+	}
+	// idleC is the timer channel while a checkpoint is pending
+	var idleC <-chan time.Time
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-s.written:
+			if idleC != nil && !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(idle)
+			idleC = timer.C
+			continue
+		case <-idleC:
+			idleC = nil
+		}
+
+		res, err := s.checkpoint(CheckpointTruncate)
+		if err != nil {
+			s.logger.Printf("[WARN ] %s: deferred checkpoint %s", tag, err)
+			continue
+		}
+		s.logger.Printf("[DEBUG] %s: deferred checkpoint busy=%t log=%d checkpointed=%d",
+			tag, res.busy, res.logFrames, res.checkpointed)
+	}
+}
@@ -0,0 +1,242 @@
+package raftsqlite3
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func walSize(t testing.TB, path string) int64 {
+	fi, err := os.Stat(path + "-wal")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return fi.Size()
+}
+
+func TestSqlite3Store_Checkpoint(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if walSize(t, path) == 0 {
+		t.Fatalf("expected a non-empty WAL")
+	}
+
+	if err := store.Checkpoint(raftsqlite3.CheckpointTruncate); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if size := walSize(t, path); size != 0 {
+		t.Fatalf("bad: %d", size)
+	}
+
+	if err := store.Checkpoint(raftsqlite3.CheckpointMode(-1)); err == nil {
+		t.Fatalf("expected invalid mode error")
+	}
+}
+
+func TestSqlite3Store_TruncateWAL(t *testing.T) {
+	fh, err := ioutil.TempFile("", "sqlite3.db")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := fh.Name()
+	defer os.Remove(path)
+
+	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=100", path)
+	store, err := raftsqlite3.New(dsn)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A reader of another connection holds the WAL
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow("select count(*) from logs").Scan(&n); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(2, "log2")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.TruncateWAL(); !errors.Is(err, raftsqlite3.ErrCheckpointBusy) {
+		t.Fatalf("expected checkpoint busy error, got: %v", err)
+	}
+
+	// Truncated once the reader is done
+	tx.Rollback()
+	if err := store.TruncateWAL(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if size := walSize(t, path); size != 0 {
+		t.Fatalf("bad: %d", size)
+	}
+}
+
+func TestSqlite3Store_AutoCheckpoint(t *testing.T) {
+	store, path := testSqlite3Store(t,
+		raftsqlite3.WithLogger(log.New(ioutil.Discard, "", 0)),
+		raftsqlite3.WithAutoCheckpoint(10*time.Millisecond, raftsqlite3.CheckpointTruncate))
+	defer os.Remove(path)
+
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The WAL is truncated in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for walSize(t, path) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("WAL not checkpointed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Close stops the checkpointing
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSqlite3Store_WALAutoCheckpoint(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithWALAutoCheckpoint(0))
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Each connection has the pragma
+	for i := 0; i < 2; i++ {
+		conn, err := store.DB().Conn(context.Background())
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer conn.Close()
+		var pages int
+		if err := conn.QueryRowContext(context.Background(), "pragma wal_autocheckpoint").Scan(&pages); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if pages != 0 {
+			t.Fatalf("bad: %d", pages)
+		}
+	}
+
+	// The default is left alone
+	store2, path2 := testSqlite3Store(t)
+	defer store2.Close()
+	defer os.Remove(path2)
+	var pages int
+	if err := store2.DB().QueryRow("pragma wal_autocheckpoint").Scan(&pages); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if pages != 1000 {
+		t.Fatalf("bad: %d", pages)
+	}
+}
+
+func TestSqlite3Store_DeferredCheckpoint(t *testing.T) {
+	store, path := testSqlite3Store(t,
+		raftsqlite3.WithLogger(log.New(ioutil.Discard, "", 0)),
+		raftsqlite3.WithDeferredCheckpoint())
+	defer store.Close()
+	defer os.Remove(path)
+
+	var pages int
+	if err := store.DB().QueryRow("pragma wal_autocheckpoint").Scan(&pages); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if pages != 0 {
+		t.Fatalf("bad: %d", pages)
+	}
+
+	// The WAL is truncated once the writes are idle
+	for i := uint64(1); i <= 10; i++ {
+		if err := store.StoreLog(testRaftLog(i, "log")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if walSize(t, path) == 0 {
+		t.Fatalf("expected a non-empty WAL")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for walSize(t, path) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("WAL not checkpointed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSqlite3Store_TimeSinceCheckpoint(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Since the open before any checkpoint
+	time.Sleep(50 * time.Millisecond)
+	if since := store.TimeSinceCheckpoint(); since < 50*time.Millisecond {
+		t.Fatalf("bad: %s", since)
+	}
+
+	if err := store.Checkpoint(raftsqlite3.CheckpointPassive); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if since := store.TimeSinceCheckpoint(); since >= 50*time.Millisecond {
+		t.Fatalf("bad: %s", since)
+	}
+}
+
+func TestSqlite3Store_CheckpointEveryN(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithCheckpointEveryN(3))
+	defer store.Close()
+	defer os.Remove(path)
+
+	time.Sleep(50 * time.Millisecond)
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if since := store.TimeSinceCheckpoint(); since < 50*time.Millisecond {
+		t.Fatalf("bad: %s", since)
+	}
+
+	// The third log checkpoints, then the count restarts
+	if err := store.StoreLog(testRaftLog(3, "log3")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if since := store.TimeSinceCheckpoint(); since >= 50*time.Millisecond {
+		t.Fatalf("bad: %s", since)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := store.StoreLog(testRaftLog(4, "log4")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if since := store.TimeSinceCheckpoint(); since < 50*time.Millisecond {
+		t.Fatalf("bad: %s", since)
+	}
+}
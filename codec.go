@@ -0,0 +1,222 @@
+package raftsqlite3
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// recodeBatchSize is the number of logs rewritten per transaction by RecodeAll.
+const recodeBatchSize = 1000
+
+// Codec encodes logs into the values stored in the logs table, and decodes
+// them back.
+type Codec interface {
+	Encode(log *raft.Log) ([]byte, error)
+	Decode(buf []byte, log *raft.Log) error
+}
+
+// MsgpackCodec is the default Codec, encoding logs with msgpack.
+type MsgpackCodec struct {
+	// version is the msgpack format version decoded, 0 for the current one.
+	version int
+}
+
+// Encode implements Codec.
+func (MsgpackCodec) Encode(log *raft.Log) ([]byte, error) {
+	buf, err := encodeMsgPack(log)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode implements Codec.
+func (c MsgpackCodec) Decode(buf []byte, log *raft.Log) error {
+	version := c.version
+	if version == 0 {
+		version = msgpackVersion
+	}
+	return decodeMsgPack(buf, log, version)
+}
+
+// keyMsgpackVersion is the conf key of the msgpack format version the logs
+// are written in.
+var keyMsgpackVersion = []byte("raftsqlite3.msgpack_version")
+
+// initMsgpackVersion reads the msgpack format version of the logs, and
+// decodes them in this version with MsgpackCodec. It records the current
+// version in a writable store that has none yet, the stores older than the
+// record being in version 1. It returns ErrCodecVersion for a version newer
+// than the current one. The queries are bound to ctx.
+func (s *Sqlite3Store) initMsgpackVersion(ctx context.Context, readOnly bool) error {
+	conn, release, err := s.openConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	query := fmt.Sprintf("select value from %s where id = ?", dbConf)
+	var val []byte
+	version := 1
+	err = conn.QueryRowContext(ctx, query, keyMsgpackVersion).Scan(&val)
+	switch {
+	case err == nil:
+		version = int(bytesToUint64(val))
+	case err == sql.ErrNoRows && !readOnly:
+		query = s.setConfQuery()
+		if _, err := conn.ExecContext(ctx, query, keyMsgpackVersion, uint64ToBytes(msgpackVersion)); err != nil {
+			return err
+		}
+		version = msgpackVersion
+	case err != sql.ErrNoRows:
+		return err
+	}
+	if version > msgpackVersion {
+		return fmt.Errorf("%w: msgpack format version %d, up to %d supported",
+			ErrCodecVersion, version, msgpackVersion)
+	}
+	if _, ok := s.opts.codec.(MsgpackCodec); ok {
+		s.opts.codec = MsgpackCodec{version: version}
+	}
+	return nil
+}
+
+// VerifyCodec encodes the log as the store would store it, with the codec
+// and the value transformer, then decodes it back and checks that the result
+// equals the log. It doesn't touch the database.
+func (s *Sqlite3Store) VerifyCodec(log *raft.Log) error {
+	val, data, err := s.encodeLog(log)
+	if err != nil {
+		return fmt.Errorf("%w at index %d: %v", ErrEncode, log.Index, err)
+	}
+	result := new(raft.Log)
+	if err := s.decodeLog(val, data, result); err != nil {
+		return fmt.Errorf("%w at index %d: %v", ErrDecode, log.Index, err)
+	}
+
+	mismatch := func(field string, expected, actual interface{}) error {
+		return fmt.Errorf("codec round trip mismatch at index %d: %s %v, decoded %v",
+			log.Index, field, expected, actual)
+	}
+	switch {
+	case result.Index != log.Index:
+		return mismatch("index", log.Index, result.Index)
+	case result.Term != log.Term:
+		return mismatch("term", log.Term, result.Term)
+	case result.Type != log.Type:
+		return mismatch("type", log.Type, result.Type)
+	case !bytes.Equal(result.Data, log.Data):
+		return mismatch("data", log.Data, result.Data)
+	case !bytes.Equal(result.Extensions, log.Extensions):
+		return mismatch("extensions", log.Extensions, result.Extensions)
+	}
+	return nil
+}
+
+// RecodeAll rewrites every log with the codec, in batches, so that the
+// fallback codec is no longer needed to read them.
+func (s *Sqlite3Store) RecodeAll() error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+
+	var after uint64
+	for {
+		last, err := s.recodeBatch(after)
+		if err != nil {
+			return err
+		}
+		if last == after {
+			return nil
+		}
+		after = last
+	}
+}
+
+// recodeBatch rewrites the next batch of logs after the index, and returns
+// the last index rewritten, or after if there is none.
+func (s *Sqlite3Store) recodeBatch(after uint64) (last uint64, err error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	ctx, cancel := s.opContext()
+	defer cancel()
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return after, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := fmt.Sprintf("select id, value from %s where id > ? order by id asc limit %d", dbLogs, recodeBatchSize)
+	rows, err := tx.QueryContext(ctx, query, s.logKey(after))
+	if err != nil {
+		return after, timeoutError(ctx, err)
+	}
+	var (
+		ids  []uint64
+		vals [][]byte
+	)
+	for rows.Next() {
+		var (
+			id  uint64
+			val []byte
+		)
+		if err = rows.Scan(&id, &val); err != nil {
+			rows.Close()
+			return after, timeoutError(ctx, err)
+		}
+		ids, vals = append(ids, id), append(vals, val)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return after, timeoutError(ctx, err)
+	}
+	if len(ids) == 0 {
+		return after, tx.Rollback()
+	}
+
+	update, err := tx.PrepareContext(ctx, fmt.Sprintf("update %s set value = ? where id = ?", dbLogs))
+	if err != nil {
+		return after, timeoutError(ctx, err)
+	}
+	defer update.Close()
+	var insertData *sql.Stmt
+	if s.opts.splitData {
+		query = fmt.Sprintf("replace into %s(id, data)values(?, ?)", dbLogData)
+		if insertData, err = tx.PrepareContext(ctx, query); err != nil {
+			return after, timeoutError(ctx, err)
+		}
+		defer insertData.Close()
+	}
+
+	for i, id := range ids {
+		log := new(raft.Log)
+		if err = s.decodeLog(vals[i], nil, log); err != nil {
+			return after, fmt.Errorf("%w at index %d: %v", ErrDecode, id, err)
+		}
+		// Inline data of a log stored before the data was split moves apart
+		val, data, err := s.encodeLog(log)
+		if err != nil {
+			return after, err
+		}
+		if _, err = update.ExecContext(ctx, val, s.logKey(id)); err != nil {
+			return after, timeoutError(ctx, err)
+		}
+		if insertData != nil && data != nil {
+			if _, err = insertData.ExecContext(ctx, s.logKey(id), data); err != nil {
+				return after, timeoutError(ctx, err)
+			}
+		}
+	}
+
+	return ids[len(ids)-1], timeoutError(ctx, tx.Commit())
+}
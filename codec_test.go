@@ -0,0 +1,321 @@
+package raftsqlite3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(log *raft.Log) ([]byte, error) {
+	return json.Marshal(log)
+}
+
+func (jsonCodec) Decode(buf []byte, log *raft.Log) error {
+	return json.Unmarshal(buf, log)
+}
+
+func TestSqlite3Store_FallbackCodec(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+
+	// Logs encoded with the default codec
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	store, err := raftsqlite3.New(path, raftsqlite3.WithCodec(jsonCodec{}),
+		raftsqlite3.WithFallbackCodec(raftsqlite3.MsgpackCodec{}))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	logs = append(logs, testRaftLog(3, "log3"))
+	if err := store.StoreLog(logs[2]); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Old and new logs are both readable
+	for _, expected := range logs {
+		result := new(raft.Log)
+		if err := store.GetLog(expected.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+
+	if err := store.RecodeAll(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	// The fallback isn't needed anymore
+	store, err = raftsqlite3.New(path, raftsqlite3.WithCodec(jsonCodec{}))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	for _, expected := range logs {
+		result := new(raft.Log)
+		if err := store.GetLog(expected.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+}
+
+func xorBytes(b []byte) ([]byte, error) {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ 0x5a
+	}
+	return out, nil
+}
+
+func TestSqlite3Store_ValueTransformer(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		opts := []raftsqlite3.Option{raftsqlite3.WithValueTransformer(xorBytes, xorBytes)}
+		if split {
+			opts = append(opts, raftsqlite3.WithSplitData())
+		}
+		store, path := testSqlite3Store(t, opts...)
+		defer store.Close()
+		defer os.Remove(path)
+
+		expected := testRaftLog(1, "log1")
+		if err := store.StoreLog(expected); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		result := new(raft.Log)
+		if err := store.GetLog(1, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+
+		// The stored value is transformed
+		var val []byte
+		if err := store.DB().QueryRow("select value from logs where id = 1").Scan(&val); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		plain, err := raftsqlite3.MsgpackCodec{}.Encode(expected)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if split {
+			log := *expected
+			log.Data = nil
+			if plain, err = (raftsqlite3.MsgpackCodec{}).Encode(&log); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+		if decoded, _ := xorBytes(val); !reflect.DeepEqual(decoded, plain) {
+			t.Fatalf("bad: %v", val)
+		}
+	}
+}
+
+// failingCodec fails to encode the log at index.
+type failingCodec struct {
+	raftsqlite3.MsgpackCodec
+	index uint64
+}
+
+func (c failingCodec) Encode(log *raft.Log) ([]byte, error) {
+	if log.Index == c.index {
+		return nil, errors.New("malformed log")
+	}
+	return c.MsgpackCodec.Encode(log)
+}
+
+func TestSqlite3Store_StoreLogs_EncodeError(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithCodec(failingCodec{index: 5}))
+	defer store.Close()
+	defer os.Remove(path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	err := store.StoreLogs(logs)
+	if !errors.Is(err, raftsqlite3.ErrEncode) {
+		t.Fatalf("expected encode error, got: %v", err)
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "at index 5") || !strings.Contains(msg, "log 5 of 10") ||
+		!strings.Contains(msg, "malformed log") {
+		t.Fatalf("bad: %s", msg)
+	}
+
+	// Nothing is stored
+	if empty, err := store.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+}
+
+// goldenLog is encoded by the current msgpack format as goldenHex.
+var (
+	goldenLog = &raft.Log{Index: 1, Term: 2, Type: raft.LogCommand, Data: []byte("golden")}
+	goldenHex = "85a444617461a6676f6c64656eaa457874656e73696f6e73c0a5496e64657801a45465726d02a45479706500"
+)
+
+func TestMsgpackCodec_Golden(t *testing.T) {
+	golden, err := hex.DecodeString(goldenHex)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	result := new(raft.Log)
+	if err := (raftsqlite3.MsgpackCodec{}).Decode(golden, result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, goldenLog) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// A change of the format must bump its version
+	buf, err := raftsqlite3.MsgpackCodec{}.Encode(goldenLog)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(buf, golden) {
+		t.Fatalf("msgpack format changed: %x", buf)
+	}
+}
+
+func TestSqlite3Store_MsgpackVersion(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+
+	// The version is recorded
+	version, err := store.GetUint64([]byte("raftsqlite3.msgpack_version"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if version != 1 {
+		t.Fatalf("bad: %d", version)
+	}
+
+	// The stored golden log is read back
+	golden, _ := hex.DecodeString(goldenHex)
+	if _, err := store.DB().Exec("insert into logs(id, value) values(1, ?)", golden); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	result := new(raft.Log)
+	if err := store.GetLog(1, result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, goldenLog) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// A newer version isn't read
+	if err := store.SetUint64([]byte("raftsqlite3.msgpack_version"), 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+	if _, err := raftsqlite3.New(path); !errors.Is(err, raftsqlite3.ErrCodecVersion) {
+		t.Fatalf("expected codec version error, got: %v", err)
+	}
+}
+
+func TestSqlite3Store_VerifyCodec(t *testing.T) {
+	store, path := testSqlite3Store(t,
+		raftsqlite3.WithSplitData(), raftsqlite3.WithValueTransformer(xorBytes, xorBytes))
+	defer store.Close()
+	defer os.Remove(path)
+
+	for _, log := range []*raft.Log{testRaftLog(1, "log1"), {Index: 2}} {
+		if err := store.VerifyCodec(log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if empty, err := store.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+
+	// A lossy transformer
+	truncate := func(b []byte) ([]byte, error) { return b[:len(b)/2], nil }
+	lossy, path2 := testSqlite3Store(t,
+		raftsqlite3.WithSplitData(), raftsqlite3.WithValueTransformer(xorBytes, truncate))
+	defer lossy.Close()
+	defer os.Remove(path2)
+	if err := lossy.VerifyCodec(testRaftLog(1, "log1")); !errors.Is(err, raftsqlite3.ErrDecode) {
+		t.Fatalf("expected decode error, got: %v", err)
+	}
+
+	// A codec dropping a field
+	dropping, path3 := testSqlite3Store(t, raftsqlite3.WithCodec(termlessCodec{}))
+	defer dropping.Close()
+	defer os.Remove(path3)
+	err := dropping.VerifyCodec(&raft.Log{Index: 1, Term: 3, Data: []byte("log1")})
+	if err == nil || !strings.Contains(err.Error(), "term") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+// termlessCodec loses the term of the logs.
+type termlessCodec struct {
+	raftsqlite3.MsgpackCodec
+}
+
+func (c termlessCodec) Encode(log *raft.Log) ([]byte, error) {
+	l := *log
+	l.Term = 0
+	return c.MsgpackCodec.Encode(&l)
+}
+
+type panicCodec struct {
+	raftsqlite3.MsgpackCodec
+}
+
+func (panicCodec) Encode(log *raft.Log) ([]byte, error) {
+	panic("encode panic")
+}
+
+func TestSqlite3Store_StoreLogs_Panic(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithCodec(panicCodec{}))
+	defer store.Close()
+	defer os.Remove(path)
+
+	err := store.StoreLog(testRaftLog(1, "log1"))
+	if !errors.Is(err, raftsqlite3.ErrPanic) {
+		t.Fatalf("expected panic error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "encode panic") || !strings.Contains(err.Error(), "panicCodec.Encode") {
+		t.Fatalf("bad: %v", err)
+	}
+	if empty, err := store.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+
+	// Panics again once rolled back
+	store2, path2 := testSqlite3Store(t, raftsqlite3.WithCodec(panicCodec{}), raftsqlite3.WithRepanic())
+	defer store2.Close()
+	defer os.Remove(path2)
+	func() {
+		defer func() {
+			if m := recover(); m != "encode panic" {
+				t.Fatalf("bad: %v", m)
+			}
+		}()
+		store2.StoreLog(testRaftLog(1, "log1"))
+	}()
+	if empty, err := store2.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+}
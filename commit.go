@@ -0,0 +1,65 @@
+package raftsqlite3
+
+import (
+	"fmt"
+)
+
+// CommitMode is when the commits of the store are synced to disk, see
+// https://www.sqlite.org/pragma.html#pragma_synchronous
+type CommitMode int
+
+const (
+	// CommitDefault keeps the synchronous setting of the data source name,
+	// FULL unless it sets "_synchronous".
+	CommitDefault CommitMode = iota
+	// CommitImmediate syncs the WAL on each commit, synchronous FULL.
+	CommitImmediate
+	// CommitGroup doesn't sync the commits, synchronous NORMAL: they're
+	// synced together by the next checkpoint or FlushCommits. The commits
+	// since are lost on a power failure, but not on a crash of the process,
+	// and the database stays consistent.
+	CommitGroup
+)
+
+// String returns the name of the mode.
+func (m CommitMode) String() string {
+	switch m {
+	case CommitDefault:
+		return "default"
+	case CommitImmediate:
+		return "immediate"
+	case CommitGroup:
+		return "group"
+	default:
+		return fmt.Sprintf("CommitMode(%d)", int(m))
+	}
+}
+
+// synchronous returns the synchronous pragma value of the mode, "" to keep
+// the one of the data source name.
+func (m CommitMode) synchronous() string {
+	switch m {
+	case CommitImmediate:
+		return "full"
+	case CommitGroup:
+		return "normal"
+	default:
+		return ""
+	}
+}
+
+// FlushCommits makes the commits so far durable, the boundary of the commits
+// grouped with CommitGroup. It syncs the WAL by checkpointing it in full,
+// waiting up to the busy timeout for the other writers and readers, and
+// returns ErrCheckpointBusy if they don't let it complete.
+func (s *Sqlite3Store) FlushCommits() error {
+	res, err := s.checkpoint(CheckpointFull)
+	if err != nil {
+		return err
+	}
+	if res.busy {
+		return fmt.Errorf("%w: %d of %d WAL frames flushed",
+			ErrCheckpointBusy, res.checkpointed, res.logFrames)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package raftsqlite3
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_CommitMode(t *testing.T) {
+	for _, c := range []struct {
+		mode        raftsqlite3.CommitMode
+		synchronous int
+	}{
+		{raftsqlite3.CommitImmediate, 2},
+		{raftsqlite3.CommitGroup, 1},
+	} {
+		store, path := testSqlite3Store(t, raftsqlite3.WithCommitMode(c.mode))
+		var synchronous int
+		if err := store.DB().QueryRow("pragma synchronous").Scan(&synchronous); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if synchronous != c.synchronous {
+			t.Fatalf("%s: bad: %d", c.mode, synchronous)
+		}
+
+		logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}
+		if err := store.StoreLogs(logs); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := store.FlushCommits(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		store.Close()
+		os.Remove(path)
+	}
+
+	if _, err := raftsqlite3.New(":memory:", raftsqlite3.WithCommitMode(raftsqlite3.CommitMode(-1))); err == nil {
+		t.Fatalf("expected invalid mode error")
+	}
+}
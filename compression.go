@@ -0,0 +1,89 @@
+package raftsqlite3
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io/ioutil"
+)
+
+// The flag byte prefixed to the values stored WithCompression.
+const (
+	flagUncompressed byte = 0
+	flagCompressed   byte = 1
+)
+
+// Compressor compresses the log values stored WithCompression.
+type Compressor interface {
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// FlateCompressor is a Compressor using DEFLATE at Level, see compress/flate,
+// 0 standing for flate.DefaultCompression.
+type FlateCompressor struct {
+	Level int
+}
+
+// Compress implements Compressor.
+func (c FlateCompressor) Compress(src []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress implements Compressor.
+func (FlateCompressor) Decompress(src []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// compress prefixes b with the flag byte, compressed with the compressor if
+// any and b has the min size.
+func (s *Sqlite3Store) compress(b []byte) ([]byte, error) {
+	c := s.opts.compressor
+	if c == nil {
+		return b, nil
+	}
+	if len(b) < s.opts.compressMinSize {
+		return append([]byte{flagUncompressed}, b...), nil
+	}
+	z, err := c.Compress(b)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{flagCompressed}, z...), nil
+}
+
+// decompress reverses compress.
+func (s *Sqlite3Store) decompress(b []byte) ([]byte, error) {
+	c := s.opts.compressor
+	if c == nil {
+		return b, nil
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("missing compression flag")
+	}
+	switch b[0] {
+	case flagUncompressed:
+		return b[1:], nil
+	case flagCompressed:
+		return c.Decompress(b[1:])
+	default:
+		return nil, fmt.Errorf("invalid compression flag %d", b[0])
+	}
+}
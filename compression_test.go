@@ -0,0 +1,91 @@
+package raftsqlite3
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_Compression(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		opts := []raftsqlite3.Option{raftsqlite3.WithCompression(raftsqlite3.FlateCompressor{}, 256)}
+		if split {
+			opts = append(opts, raftsqlite3.WithSplitData())
+		}
+		store, path := testSqlite3Store(t, opts...)
+		defer store.Close()
+		defer os.Remove(path)
+
+		big := strings.Repeat("x", 4096)
+		logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, big), testRaftLog(3, "log3")}
+		if err := store.StoreLogs(logs); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// The mixed rows decode
+		result, err := store.GetLogRange(1, 3)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(result, logs) {
+			t.Fatalf("bad: %#v", result)
+		}
+
+		// Only the large values are compressed
+		column, table := "value", "logs"
+		if split {
+			column, table = "data", "log_data"
+		}
+		for idx, flag := range map[uint64]byte{1: 0, 2: 1, 3: 0} {
+			var val []byte
+			query := "select " + column + " from " + table + " where id = ?"
+			if err := store.DB().QueryRow(query, idx).Scan(&val); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if len(val) == 0 || val[0] != flag {
+				t.Fatalf("bad flag of %d: %v", idx, val)
+			}
+			if idx == 2 && len(val) >= len(big) {
+				t.Fatalf("bad size: %d", len(val))
+			}
+		}
+	}
+}
+
+func TestSqlite3Store_Compression_ValueTransformer(t *testing.T) {
+	store, path := testSqlite3Store(t,
+		raftsqlite3.WithCompression(raftsqlite3.FlateCompressor{}, 256),
+		raftsqlite3.WithValueTransformer(xorBytes, xorBytes))
+	defer store.Close()
+	defer os.Remove(path)
+
+	big := strings.Repeat("x", 4096)
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, big)}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	result, err := store.GetLogRange(1, 2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, logs) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// The transformer applies to the compressed value, flag byte included
+	var val []byte
+	if err := store.DB().QueryRow("select value from logs where id = ?", 2).Scan(&val); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	plain, err := xorBytes(val)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(plain) == 0 || plain[0] != 1 || len(plain) >= len(big) {
+		t.Fatalf("bad: %v", plain)
+	}
+}
@@ -0,0 +1,195 @@
+package raftsqlite3
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_ConcurrentReadWrite(t *testing.T) {
+	testConcurrentReadWrite(t)
+}
+
+func TestSqlite3Store_ConcurrentReadWrite_ReadBusyTimeout(t *testing.T) {
+	testConcurrentReadWrite(t, raftsqlite3.WithReadBusyTimeout(10*time.Second))
+}
+
+// testConcurrentReadWrite runs a writer and several readers on the store for
+// a few seconds, while it's checkpointed in the background.
+func testConcurrentReadWrite(t *testing.T, opts ...raftsqlite3.Option) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	opts = append(opts,
+		raftsqlite3.WithAutoCheckpoint(50*time.Millisecond, raftsqlite3.CheckpointPassive),
+		raftsqlite3.WithLogger(log.New(ioutil.Discard, "", 0)))
+	store, path := testSqlite3Store(t, opts...)
+	defer store.Close()
+	defer os.Remove(path)
+
+	const (
+		duration = 2 * time.Second
+		readers  = 4
+		batch    = 16
+	)
+	var (
+		last      uint64
+		compacted uint64
+		wg        sync.WaitGroup
+		stop      = make(chan struct{})
+		errs      = make(chan error, readers+1)
+	)
+
+	// The writer appends batches and compacts the head now and then
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for next := uint64(1); ; next += batch {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			logs := make([]*raft.Log, 0, batch)
+			for i := next; i < next+batch; i++ {
+				logs = append(logs, testRaftLog(i, fmt.Sprintf("log%d", i)))
+			}
+			if err := store.StoreLogs(logs); err != nil {
+				errs <- fmt.Errorf("StoreLogs: %s", err)
+				return
+			}
+			atomic.StoreUint64(&last, next+batch-1)
+
+			if next%(batch*64) == 1 && next > batch*64 {
+				atomic.StoreUint64(&compacted, next-batch*32)
+				if err := store.DeleteRange(1, next-batch*32); err != nil {
+					errs <- fmt.Errorf("DeleteRange: %s", err)
+					return
+				}
+			}
+		}
+	}()
+
+	// The readers read the logs stored so far
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := new(raft.Log)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				idx := atomic.LoadUint64(&last)
+				if idx == 0 {
+					continue
+				}
+				err := store.GetLog(idx, result)
+				if err == raft.ErrLogNotFound && idx <= atomic.LoadUint64(&compacted) {
+					// Compacted since it was read
+					continue
+				}
+				if err != nil {
+					errs <- fmt.Errorf("GetLog(%d): %s", idx, err)
+					return
+				}
+				if result.Index != idx {
+					errs <- fmt.Errorf("GetLog(%d): bad index %d", idx, result.Index)
+					return
+				}
+				if _, err := store.LastIndex(); err != nil {
+					errs <- fmt.Errorf("LastIndex: %s", err)
+					return
+				}
+				if _, err := store.RangeChecksum(idx-batch+1, idx); err != nil {
+					errs <- fmt.Errorf("RangeChecksum: %s", err)
+					return
+				}
+				logs, err := store.GetLogRange(idx-batch+1, idx)
+				if err != nil {
+					errs <- fmt.Errorf("GetLogRange(%d, %d): %s", idx-batch+1, idx, err)
+					return
+				}
+				if len(logs) != batch || logs[batch-1].Index != idx {
+					errs <- fmt.Errorf("GetLogRange(%d, %d): bad logs %d", idx-batch+1, idx, len(logs))
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(duration)
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestSqlite3Store_ConcurrentOpen(t *testing.T) {
+	fh, err := ioutil.TempFile("", "sqlite3.db")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := fh.Name()
+	fh.Close()
+	os.Remove(path)
+	defer os.Remove(path)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store, err := raftsqlite3.New(path, raftsqlite3.WithOpenTimeout(10*time.Second))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = store.StoreLog(testRaftLog(uint64(i+1), "log"))
+			store.Close()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// A held write lock times the initialization out
+	store, err := raftsqlite3.New(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	tx, err := store.DB().Begin()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("create table held(id integer)"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	start := time.Now()
+	_, err = raftsqlite3.New(path, raftsqlite3.WithOpenTimeout(200*time.Millisecond))
+	if !errors.Is(err, raftsqlite3.ErrOpenTimeout) {
+		t.Fatalf("expected open timeout error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("bad: %s", elapsed)
+	}
+}
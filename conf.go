@@ -0,0 +1,110 @@
+package raftsqlite3
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// KeyValue is a key/value pair of the conf table.
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// RangePrefix returns the key/value pairs whose key starts with prefix, in
+// key order, e.g. the keys of a namespace. WithConfIndex covers the scan.
+func (s *Sqlite3Store) RangePrefix(prefix []byte) ([]KeyValue, error) {
+	// A nil prefix would bind null
+	prefix = append([]byte{}, prefix...)
+	query := fmt.Sprintf("select id, value from %s where id >= ?", dbConf)
+	args := []interface{}{prefix}
+	if end := prefixEnd(prefix); end != nil {
+		query += " and id < ?"
+		args = append(args, end)
+	}
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query+" order by id asc", args...)
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	defer rows.Close()
+
+	var kvs []KeyValue
+	for rows.Next() {
+		var kv KeyValue
+		if err := rows.Scan(&kv.Key, &kv.Value); err != nil {
+			return nil, timeoutError(ctx, err)
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs, timeoutError(ctx, rows.Err())
+}
+
+// prefixEnd returns the smallest key greater than all the keys starting with
+// prefix, or nil if there's none.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// RangeOrdered calls fn with the conf key/value pairs in the order the keys
+// were first set, until fn returns an error, which is returned. It requires
+// WithConfOrdering, otherwise ErrNotSupported is returned.
+func (s *Sqlite3Store) RangeOrdered(fn func(key, value []byte) error) error {
+	if !s.opts.confOrdering {
+		return ErrNotSupported
+	}
+
+	query := fmt.Sprintf("select id, value from %s order by seq asc, id asc", dbConf)
+	rows, err := s.reader().Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k, v []byte
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// setConfQuery returns the statement setting a conf key to a value. With
+// WithConfOrdering a new key takes the next seq, and a key set again keeps it.
+func (s *Sqlite3Store) setConfQuery() string {
+	if s.opts.confOrdering {
+		return fmt.Sprintf("insert into %s(id, value, seq)values(?, ?, (select coalesce(max(seq), 0) + 1 from %s))"+
+			" on conflict(id) do update set value = excluded.value", dbConf, dbConf)
+	}
+	return fmt.Sprintf("replace into %s(id, value)values(?, ?)", dbConf)
+}
+
+// initConfSeqColumn adds the indexed seq column to the conf table, and orders
+// the keys present before the column existed by their rowid.
+func initConfSeqColumn(tx *sql.Tx) error {
+	added, err := addColumnIfNotExists(tx, dbConf, "seq", "integer")
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("create index if not exists %s_seq on %s(seq)", dbConf, dbConf)
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if added {
+		query = fmt.Sprintf("update %s set seq = rowid", dbConf)
+		_, err = tx.Exec(query)
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package raftsqlite3
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_RangePrefix(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithConfIndex())
+	defer os.Remove(path)
+
+	keys := [][]byte{
+		[]byte("a"), []byte("ns/a"), []byte("ns/b"), []byte("ns0"),
+		{0xff}, {0xff, 0x00}, {0xff, 0xff},
+	}
+	for _, k := range keys {
+		if err := store.Set(k, k); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	for _, c := range []struct {
+		prefix   []byte
+		expected [][]byte
+	}{
+		{[]byte("ns/"), keys[1:3]},
+		{[]byte("ns"), keys[1:4]},
+		{[]byte("x"), nil},
+		{[]byte{0xff}, keys[4:]},
+		{[]byte("a"), keys[:1]},
+	} {
+		kvs, err := store.RangePrefix(c.prefix)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var result [][]byte
+		for _, kv := range kvs {
+			if !reflect.DeepEqual(kv.Key, kv.Value) {
+				t.Fatalf("bad: %#v", kv)
+			}
+			result = append(result, kv.Key)
+		}
+		if !reflect.DeepEqual(result, c.expected) {
+			t.Fatalf("bad prefix %q: %q", c.prefix, result)
+		}
+	}
+
+	version, err := store.SchemaVersion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if version != 1|1<<8 {
+		t.Fatalf("bad: %d", version)
+	}
+	store.Close()
+
+	// Reopening without the option drops the index
+	store, err = raftsqlite3.New(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	var n int
+	row := store.DB().QueryRow("select count(*) from sqlite_master where name = 'conf_id_value'")
+	if err := row.Scan(&n); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+	if version, err := store.SchemaVersion(); err != nil || version != 1 {
+		t.Fatalf("bad: %d, %v", version, err)
+	}
+}
+
+func TestSqlite3Store_RangeOrdered(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+	if err := store.RangeOrdered(func(k, v []byte) error { return nil }); err != raftsqlite3.ErrNotSupported {
+		t.Fatalf("expected not supported error, got: %v", err)
+	}
+	// Keys set before the ordering come first
+	if err := store.Set([]byte("z"), []byte("0")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	store, err := raftsqlite3.New(path, raftsqlite3.WithConfOrdering())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	for _, k := range []string{"b", "a", "c", "b"} {
+		if err := store.Set([]byte(k), []byte(k)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	var keys []string
+	err = store.RangeOrdered(func(k, v []byte) error {
+		if !strings.HasPrefix(string(k), "raftsqlite3.") {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"z", "b", "a", "c"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = store.RangeOrdered(func(k, v []byte) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("bad: %d, %v", n, err)
+	}
+}
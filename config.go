@@ -0,0 +1,65 @@
+package raftsqlite3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// sqliteHeader is the magic string starting a database file.
+const sqliteHeader = "SQLite format 3\x00"
+
+// ValidateConfig checks the options and the data source name that New would
+// be given, without opening the database, e.g. to fail fast on a bad
+// configuration at startup. It checks the invariants of the options, the
+// syntax of the query parameters of dsn, and that an existing database file
+// is a sqlite3 database of the page size of WithPageSize.
+func ValidateConfig(dsn string, opts ...Option) error {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := o.validate(); err != nil {
+		return err
+	}
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		if _, err := url.ParseQuery(dsn[i+1:]); err != nil {
+			return fmt.Errorf("invalid data source name %q: %v", dsn, err)
+		}
+	}
+
+	path := dsnPath(dsn)
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := make([]byte, 100)
+	n, err := io.ReadFull(f, header)
+	if n == 0 && err == io.EOF {
+		// An empty file becomes a new database
+		return nil
+	}
+	if err != nil || string(header[:len(sqliteHeader)]) != sqliteHeader {
+		return fmt.Errorf("%s is not a sqlite3 database", path)
+	}
+	if o.pageSize != 0 {
+		size := int(binary.BigEndian.Uint16(header[16:18]))
+		if size == 1 {
+			size = 65536
+		}
+		if size != o.pageSize {
+			return fmt.Errorf("%w: the page size is %d, not %d", ErrSchemaMismatch, size, o.pageSize)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package raftsqlite3
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestValidateConfig(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithPageSize(8192))
+	store.Close()
+	defer os.Remove(path)
+
+	if err := raftsqlite3.ValidateConfig(path, raftsqlite3.WithPageSize(8192)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := raftsqlite3.ValidateConfig(path+".new", raftsqlite3.WithPageSize(4096)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := raftsqlite3.ValidateConfig(":memory:"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The page size of an existing file
+	err := raftsqlite3.ValidateConfig(path, raftsqlite3.WithPageSize(4096))
+	if !errors.Is(err, raftsqlite3.ErrSchemaMismatch) {
+		t.Fatalf("expected schema mismatch error, got: %v", err)
+	}
+	// The options and the DSN
+	if err := raftsqlite3.ValidateConfig(path, raftsqlite3.WithPageSize(1000)); err == nil {
+		t.Fatalf("should fail on an invalid page size")
+	}
+	if err := raftsqlite3.ValidateConfig(path + "?_busy_timeout=%zz"); err == nil {
+		t.Fatalf("should fail on an invalid query")
+	}
+	// Not a database
+	other := path + ".txt"
+	if err := ioutil.WriteFile(other, []byte("not a database"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(other)
+	if err := raftsqlite3.ValidateConfig(other); err == nil {
+		t.Fatalf("should fail on a file not a database")
+	}
+}
@@ -0,0 +1,142 @@
+package raftsqlite3
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// connector opens the sqlite3 connections of a store, and applies the
+// pragmas of the store options to each new connection.
+type connector struct {
+	driver *sqlite3.SQLiteDriver
+	dsn    string
+}
+
+func newConnector(dsn string, o *options) *connector {
+	return newPragmaConnector(dsn, o.pragmas())
+}
+
+// newReadConnector returns the connector of the read connections, which wait
+// for the read busy timeout instead of the one in dsn.
+func newReadConnector(dsn string, o *options) *connector {
+	timeout := strconv.FormatInt(o.readBusyTimeout.Milliseconds(), 10)
+	dsn = setDSNParam(dsn, "_busy_timeout", timeout, "_timeout")
+	return newPragmaConnector(dsn, o.pragmas())
+}
+
+func newPragmaConnector(dsn string, pragmas []string) *connector {
+	return &connector{
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				for _, pragma := range pragmas {
+					if _, err := conn.Exec(pragma, nil); err != nil {
+						return fmt.Errorf("%s: %s", pragma, err)
+					}
+				}
+				return nil
+			},
+		},
+		dsn: dsn,
+	}
+}
+
+// Connect implements driver.Connector.
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver implements driver.Connector.
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// setDSNParam sets the query parameter key of dsn to value, and removes the
+// aliases of key.
+func setDSNParam(dsn, key, value string, aliases ...string) string {
+	name, query := dsn, ""
+	if pos := strings.IndexRune(dsn, '?'); pos >= 0 {
+		name, query = dsn[:pos], dsn[pos+1:]
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		// Leave it to the driver to report
+		return dsn
+	}
+	for _, alias := range aliases {
+		params.Del(alias)
+	}
+	params.Set(key, value)
+	return name + "?" + params.Encode()
+}
+
+// takeDSNParam removes the query parameter key of dsn and its aliases, and
+// returns the value of the first one present.
+func takeDSNParam(dsn, key string, aliases ...string) (string, string) {
+	pos := strings.IndexRune(dsn, '?')
+	if pos < 0 {
+		return dsn, ""
+	}
+	params, err := url.ParseQuery(dsn[pos+1:])
+	if err != nil {
+		// Leave it to the driver to report
+		return dsn, ""
+	}
+	var value string
+	for _, k := range append([]string{key}, aliases...) {
+		if v := params.Get(k); v != "" && value == "" {
+			value = v
+		}
+		params.Del(k)
+	}
+	return dsn[:pos] + "?" + params.Encode(), value
+}
+
+// dsnPath returns the path of the database file in dsn, a plain path or a
+// file: URI, or "" for an in-memory database.
+func dsnPath(dsn string) string {
+	path, query := dsn, ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		path, query = dsn[:i], dsn[i+1:]
+	}
+	if strings.HasPrefix(path, "file:") {
+		if params, err := url.ParseQuery(query); err == nil && params.Get("mode") == "memory" {
+			return ""
+		}
+		path = strings.TrimPrefix(path, "file:")
+		// Skip the authority of file://host/path, which can only be localhost
+		if strings.HasPrefix(path, "//") {
+			path = path[2:]
+			if i := strings.IndexByte(path, '/'); i >= 0 {
+				path = path[i:]
+			} else {
+				path = ""
+			}
+		}
+		if unescaped, err := url.PathUnescape(path); err == nil {
+			path = unescaped
+		}
+	}
+	if path == ":memory:" {
+		return ""
+	}
+	return path
+}
+
+// fileURI turns a plain path dsn into a file: URI with the same query, so
+// that sqlite3 honors the URI parameters.
+func fileURI(dsn string) string {
+	if strings.HasPrefix(dsn, "file:") {
+		return dsn
+	}
+	path, query := dsn, ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		path, query = dsn[:i], dsn[i:]
+	}
+	return "file:" + (&url.URL{Path: path}).EscapedPath() + query
+}
@@ -0,0 +1,63 @@
+package raftsqlite3
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// IsRaftSqlite3 returns true if the file at path is the database of a store,
+// holding the logs and conf tables with their id and value columns, and
+// false for another SQLite database or a file that isn't one. It opens the
+// file read-only, and never creates or changes it.
+func IsRaftSqlite3(path string) (bool, error) {
+	// Opening a missing file would create it
+	if _, err := os.Stat(path); err != nil {
+		return false, err
+	}
+	db, err := sql.Open("sqlite3", setDSNParam(fileURI(path), "mode", "ro"))
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	for _, table := range []string{dbLogs, dbConf} {
+		columns, err := tableColumns(db, table)
+		if e, ok := err.(sqlite3.Error); ok && e.Code == sqlite3.ErrNotADB {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !columns["id"] || !columns["value"] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// tableColumns returns the set of the column names of table, empty if there's
+// no such table.
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("pragma table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,51 @@
+package raftsqlite3
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestIsRaftSqlite3(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+	store.Close()
+	if ok, err := raftsqlite3.IsRaftSqlite3(path); err != nil || !ok {
+		t.Fatalf("bad: %t, %v", ok, err)
+	}
+
+	// Another SQLite database
+	other := path + ".other"
+	defer os.Remove(other)
+	db, err := sql.Open("sqlite3", other)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := db.Exec("create table logs(id integer primary key, line text)"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db.Close()
+	if ok, err := raftsqlite3.IsRaftSqlite3(other); err != nil || ok {
+		t.Fatalf("bad: %t, %v", ok, err)
+	}
+
+	// Not a database
+	text := path + ".txt"
+	defer os.Remove(text)
+	if err := ioutil.WriteFile(text, []byte("not a database, but long enough to have a header"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ok, err := raftsqlite3.IsRaftSqlite3(text); err != nil || ok {
+		t.Fatalf("bad: %t, %v", ok, err)
+	}
+
+	if _, err := raftsqlite3.IsRaftSqlite3(path + ".missing"); err == nil {
+		t.Fatalf("should fail on a missing file")
+	}
+	if _, err := os.Stat(path + ".missing"); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package raftsqlite3
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_Diff(t *testing.T) {
+	leader, path := testSqlite3Store(t)
+	defer leader.Close()
+	defer os.Remove(path)
+	follower, path2 := testSqlite3Store(t)
+	defer follower.Close()
+	defer os.Remove(path2)
+
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2"), testRaftLog(3, "log3"), testRaftLog(5, "log5")}
+	if err := leader.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	diverged := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(3, "other"), testRaftLog(4, "log4")}
+	if err := follower.StoreLogs(diverged); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	diffs, err := leader.Diff(follower, 1, 4)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []raftsqlite3.IndexDiff{
+		{Index: 2, InSelf: true},
+		{Index: 3, InSelf: true, InOther: true},
+		{Index: 4, InOther: true},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("bad: %+v", diffs)
+	}
+
+	if diffs, err = leader.Diff(leader, 1, 5); err != nil || diffs != nil {
+		t.Fatalf("bad: %+v, %v", diffs, err)
+	}
+}
@@ -0,0 +1,85 @@
+package raftsqlite3
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/raft"
+)
+
+// dumpLog is a log in the output of DumpJSON.
+type dumpLog struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Type  string `json:"type"`
+	Data  []byte `json:"data"`
+}
+
+// dumpKeyValue is a conf key/value pair in the output of DumpJSON.
+type dumpKeyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// DumpJSON writes the logs and the conf of the store to w as a JSON document
+// for a human to read, e.g. in a bug report:
+//
+//	{"logs":[{"index":1,"term":1,"type":"LogCommand","data":"..."}],
+//	 "conf":[{"key":"...","value":"..."}]}
+//
+// The logs are decoded, in index order, and the data, keys and values are in
+// base64. The document is written as the logs and the conf are read, without
+// holding them in memory.
+func (s *Sqlite3Store) DumpJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	sep := ""
+	// The encoder ends each value with a newline
+	write := func(v interface{}) error {
+		if _, err := bw.WriteString(sep); err != nil {
+			return err
+		}
+		sep = ","
+		return enc.Encode(v)
+	}
+
+	if _, err := bw.WriteString(`{"logs":[`); err != nil {
+		return err
+	}
+	err := s.eachLog(context.Background(), "order by id asc", nil, func(log *raft.Log) error {
+		return write(dumpLog{Index: log.Index, Term: log.Term, Type: log.Type.String(), Data: log.Data})
+	})
+	if err != nil {
+		return err
+	}
+
+	sep = ""
+	if _, err := bw.WriteString(`],"conf":[`); err != nil {
+		return err
+	}
+	rows, err := s.reader().Query(fmt.Sprintf("select id, value from %s order by id asc", dbConf))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kv dumpKeyValue
+		if err := rows.Scan(&kv.Key, &kv.Value); err != nil {
+			return err
+		}
+		if err := write(kv); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := bw.WriteString("]}\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,60 @@
+package raftsqlite3
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestSqlite3Store_DumpJSON(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	logs := []*raft.Log{
+		&raft.Log{Index: 1, Term: 1, Type: raft.LogCommand, Data: []byte("log1")},
+		&raft.Log{Index: 2, Term: 2, Type: raft.LogNoop},
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Set([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.DumpJSON(&buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	var doc struct {
+		Logs []struct {
+			Index uint64
+			Term  uint64
+			Type  string
+			Data  []byte
+		}
+		Conf []struct {
+			Key   []byte
+			Value []byte
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("err: %s, %s", err, buf.String())
+	}
+	if len(doc.Logs) != 2 || doc.Logs[0].Index != 1 || doc.Logs[0].Type != "LogCommand" ||
+		string(doc.Logs[0].Data) != "log1" || doc.Logs[1].Term != 2 || doc.Logs[1].Type != "LogNoop" {
+		t.Fatalf("bad: %+v", doc.Logs)
+	}
+	found := false
+	for _, kv := range doc.Conf {
+		if string(kv.Key) == "k" && string(kv.Value) == "v" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("bad: %+v", doc.Conf)
+	}
+}
@@ -0,0 +1,60 @@
+package raftsqlite3
+
+import (
+	"context"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// NewFromBytes opens a store over an in-memory database deserialized from
+// image, e.g. a golden database file or the output of Serialize, without
+// touching the disk. The image is copied, and a WAL mode image is turned into
+// a rollback journal one, as an in-memory database has no WAL. The store is
+// pinned to one connection, which holds the database, so WithReadBusyTimeout
+// is ignored.
+func NewFromBytes(image []byte, opts ...Option) (*Sqlite3Store, error) {
+	image = append([]byte(nil), image...)
+	// The file format version numbers, 2 for WAL mode
+	if len(image) >= 20 && image[18] == 2 && image[19] == 2 {
+		image[18], image[19] = 1, 1
+	}
+	opts = append(opts, func(o *options) {
+		o.image = image
+	})
+	return New(":memory:", opts...)
+}
+
+// deserialize replaces the main database of the store with image, after
+// pinning the store to one connection for an in-memory database.
+func (s *Sqlite3Store) deserialize(image []byte) error {
+	s.pinConnection()
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(dc interface{}) error {
+		return dc.(*sqlite3.SQLiteConn).Deserialize(image, "main")
+	})
+}
+
+// Serialize returns the image of the database of the store, as the content of
+// its database file would be after a checkpoint, which NewFromBytes opens.
+func (s *Sqlite3Store) Serialize() ([]byte, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var image []byte
+	err = conn.Raw(func(dc interface{}) error {
+		image, err = dc.(*sqlite3.SQLiteConn).Serialize("main")
+		return err
+	})
+	return image, err
+}
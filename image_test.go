@@ -0,0 +1,68 @@
+package raftsqlite3
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_NewFromBytes_Serialize(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("term"), 3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	// A golden database file
+	golden, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	mem, err := raftsqlite3.NewFromBytes(golden)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer mem.Close()
+	if main, _, _ := mem.Files(); main != "" {
+		t.Fatalf("bad: %s", main)
+	}
+	for _, expected := range logs {
+		result := new(raft.Log)
+		if err := mem.GetLog(expected.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+	if v, err := mem.GetUint64([]byte("term")); err != nil || v != 3 {
+		t.Fatalf("bad: %d, %v", v, err)
+	}
+
+	// The in-memory store goes on, and round-trips
+	if err := mem.StoreLog(testRaftLog(3, "log3")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	image, err := mem.Serialize()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	again, err := raftsqlite3.NewFromBytes(image)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer again.Close()
+	if last, err := again.LastIndex(); err != nil || last != 3 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+}
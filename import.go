@@ -0,0 +1,167 @@
+package raftsqlite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// importBatchSize is the number of logs per transaction of Import.
+	importBatchSize = 1000
+	// fastImportBatchSize is the number of logs per transaction of the
+	// fast import.
+	fastImportBatchSize = 50000
+)
+
+// Import stores the logs returned by next until it returns a nil log, in
+// large transactions, and returns the number of logs stored. It's meant for
+// bootstrapping a store with many logs.
+//
+// With WithFastImport, the secondary indexes of the logs table are dropped
+// during the import and recreated at the end, and the connection doesn't
+// sync until then. The log index itself is the rowid of the logs table, so
+// there is no primary key index to drop.
+//
+// The logs are encoded and stored in the same rows as with StoreLogs, but
+// Import bypasses its guards and side effects: WithRejectIndexZero,
+// WithRejectBelowBase, WithMirror, WithWriteRateLimit and WithWALSizeLimit
+// don't apply, the post-commit hook isn't called, and neither the trim of
+// WithMaxDiskBytes nor the checkpoint of WithCheckpointEveryN run.
+func (s *Sqlite3Store) Import(next func() (*raft.Log, error)) (n uint64, err error) {
+	if err = s.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer s.endWrite()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	batchSize := importBatchSize
+	if s.opts.fastImport {
+		batchSize = fastImportBatchSize
+		restore, err := prepareFastImport(ctx, conn)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			if e := restore(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	for {
+		logs := make([]*raft.Log, 0, batchSize)
+		for len(logs) < batchSize {
+			log, err := next()
+			if err != nil {
+				return n, err
+			}
+			if log == nil {
+				break
+			}
+			logs = append(logs, log)
+		}
+		if len(logs) == 0 {
+			return n, nil
+		}
+		if err := s.importLogs(ctx, conn, logs); err != nil {
+			return n, err
+		}
+		n += uint64(len(logs))
+		if len(logs) < batchSize {
+			return n, nil
+		}
+	}
+}
+
+// importLogs stores the logs in one transaction of conn.
+func (s *Sqlite3Store) importLogs(ctx context.Context, conn *sql.Conn, logs []*raft.Log) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	inserter, err := s.newLogInserter(ctx, tx, "insert")
+	if err != nil {
+		return err
+	}
+	defer inserter.Close()
+
+	for _, log := range logs {
+		if _, err = inserter.insert(log); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// prepareFastImport drops the secondary indexes of the logs table and turns
+// off syncing on conn. The returned function recreates the indexes and
+// restores syncing.
+func prepareFastImport(ctx context.Context, conn *sql.Conn) (func() error, error) {
+	var synchronous int
+	if err := conn.QueryRowContext(ctx, "pragma synchronous").Scan(&synchronous); err != nil {
+		return nil, err
+	}
+
+	// The automatic indexes have no sql, and can't be dropped
+	query := fmt.Sprintf("select name, sql from sqlite_master where type = 'index' and tbl_name = '%s' and sql is not null", dbLogs)
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[string]string)
+	for rows.Next() {
+		var name, sql string
+		if err := rows.Scan(&name, &sql); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		indexes[name] = sql
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	dropped := make(map[string]string)
+	restore := func() error {
+		for name, sql := range dropped {
+			if _, err := conn.ExecContext(ctx, sql); err != nil {
+				return err
+			}
+			delete(dropped, name)
+		}
+		query := fmt.Sprintf("pragma synchronous = %d", synchronous)
+		_, err := conn.ExecContext(ctx, query)
+		return err
+	}
+
+	if _, err := conn.ExecContext(ctx, "pragma synchronous = OFF"); err != nil {
+		return nil, err
+	}
+	for name, sql := range indexes {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("drop index %s", name)); err != nil {
+			restore()
+			return nil, err
+		}
+		dropped[name] = sql
+	}
+	return restore, nil
+}
@@ -0,0 +1,99 @@
+package raftsqlite3
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func testImportLogs(n int) func() (*raft.Log, error) {
+	i := 0
+	return func() (*raft.Log, error) {
+		if i == n {
+			return nil, nil
+		}
+		i++
+		return &raft.Log{
+			Index: uint64(i),
+			Term:  uint64(i/100 + 1),
+			Data:  []byte(fmt.Sprintf("log%d", i)),
+		}, nil
+	}
+}
+
+func testImport(t *testing.T, opts ...raftsqlite3.Option) {
+	const count = 2500
+	opts = append(opts, raftsqlite3.WithTermColumn())
+
+	// The reference store
+	store, path := testSqlite3Store(t, opts...)
+	defer store.Close()
+	defer os.Remove(path)
+	next := testImportLogs(count)
+	for {
+		log, _ := next()
+		if log == nil {
+			break
+		}
+		if err := store.StoreLog(log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	imported, importedPath := testSqlite3Store(t, opts...)
+	defer imported.Close()
+	defer os.Remove(importedPath)
+	n, err := imported.Import(testImportLogs(count))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != count {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// The final state is identical to the reference store
+	sum, err := store.RangeChecksum(0, count)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	importedSum, err := imported.RangeChecksum(0, count)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if sum != importedSum {
+		t.Fatalf("bad: %x != %x", sum, importedSum)
+	}
+	logs, err := store.GetLogsByTerm(5)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	importedLogs, err := imported.GetLogsByTerm(5)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(logs) != 100 || !reflect.DeepEqual(logs, importedLogs) {
+		t.Fatalf("bad: %d logs", len(importedLogs))
+	}
+
+	// The secondary indexes are back
+	var indexes int
+	query := "select count(*) from sqlite_master where type = 'index' and name = 'logs_term'"
+	if err := imported.DB().QueryRow(query).Scan(&indexes); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if indexes != 1 {
+		t.Fatalf("bad: %d", indexes)
+	}
+}
+
+func TestSqlite3Store_Import(t *testing.T) {
+	testImport(t)
+}
+
+func TestSqlite3Store_FastImport(t *testing.T) {
+	testImport(t, raftsqlite3.WithFastImport())
+}
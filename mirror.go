@@ -0,0 +1,59 @@
+package raftsqlite3
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// The writes to the mirror of WithMirror are applied with the public write
+// methods of the mirror store, while the transaction of the primary is still
+// open: a failed mirror write rolls the primary write back. The mirror writes
+// are idempotent, logs being replaced rather than inserted, as the primary
+// retries its busy writes.
+
+// mirrorStoreLogs stores the logs into the mirror if any.
+func (s *Sqlite3Store) mirrorStoreLogs(logs []*raft.Log) error {
+	m := s.opts.mirror
+	if m == nil || len(logs) == 0 {
+		return nil
+	}
+	if err := m.beginWrite(); err != nil {
+		return fmt.Errorf("%w: %v", ErrMirror, err)
+	}
+	defer m.endWrite()
+
+	start := time.Now()
+	for retries := 0; ; retries++ {
+		if _, err := m.doStoreLogs(logs, "replace", nil); err != nil {
+			if m.waitIfBusy("StoreLogs()", err, 100*time.Millisecond, start, retries) {
+				continue
+			}
+			return fmt.Errorf("%w: %v", ErrMirror, err)
+		}
+
+		m.postCommit(logs)
+		return nil
+	}
+}
+
+// mirrorDeleteRange deletes the range of logs from the mirror if any.
+func (s *Sqlite3Store) mirrorDeleteRange(min, max uint64) error {
+	if m := s.opts.mirror; m != nil {
+		if _, err := m.DeleteRangeN(min, max); err != nil {
+			return fmt.Errorf("%w: %v", ErrMirror, err)
+		}
+	}
+	return nil
+}
+
+// mirrorSet sets the key to the value in the mirror if any.
+func (s *Sqlite3Store) mirrorSet(k, v []byte) error {
+	if m := s.opts.mirror; m != nil {
+		if err := m.Set(k, v); err != nil {
+			return fmt.Errorf("%w: %v", ErrMirror, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package raftsqlite3
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_Mirror(t *testing.T) {
+	mirror, path := testSqlite3Store(t)
+	defer os.Remove(path)
+	store, path2 := testSqlite3Store(t, raftsqlite3.WithMirror(mirror))
+	defer store.Close()
+	defer os.Remove(path2)
+
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2"), testRaftLog(3, "log3")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DeleteRange(1, 1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("term"), 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := store.IncrementUint64([]byte("count"), 3); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The writes are applied to both stores
+	for _, s := range []*raftsqlite3.Sqlite3Store{store, mirror} {
+		if first, err := s.FirstIndex(); err != nil || first != 2 {
+			t.Fatalf("bad: %d, %v", first, err)
+		}
+		for _, expected := range logs[1:] {
+			result := new(raft.Log)
+			if err := s.GetLog(expected.Index, result); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			if !reflect.DeepEqual(expected, result) {
+				t.Fatalf("bad: %#v", result)
+			}
+		}
+		if v, err := s.GetUint64([]byte("term")); err != nil || v != 2 {
+			t.Fatalf("bad: %d, %v", v, err)
+		}
+		if v, err := s.GetUint64([]byte("count")); err != nil || v != 3 {
+			t.Fatalf("bad: %d, %v", v, err)
+		}
+	}
+
+	// A failed mirror write fails the whole write
+	mirror.Close()
+	err := store.StoreLog(testRaftLog(4, "log4"))
+	if !errors.Is(err, raftsqlite3.ErrMirror) {
+		t.Fatalf("expected mirror error, got: %v", err)
+	}
+	if last, err := store.LastIndex(); err != nil || last != 3 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+	if err := store.SetUint64([]byte("term"), 3); !errors.Is(err, raftsqlite3.ErrMirror) {
+		t.Fatalf("expected mirror error, got: %v", err)
+	}
+	if v, err := store.GetUint64([]byte("term")); err != nil || v != 2 {
+		t.Fatalf("bad: %d, %v", v, err)
+	}
+}
@@ -0,0 +1,40 @@
+package raftsqlite3
+
+import "fmt"
+
+// OpenInfo describes the store opened by OpenWithInfo.
+type OpenInfo struct {
+	// ReadOnly is true if the store was opened in query_only mode.
+	ReadOnly bool
+	// Created is true if the tables were created by the open, i.e. the
+	// store is new.
+	Created bool
+	// SchemaVersion is the schema version of the store, see SchemaVersion.
+	SchemaVersion int
+	// LogCount is the number of logs the store holds.
+	LogCount uint64
+}
+
+// OpenWithInfo is like New, but also returns how the store was found, e.g.
+// to tell the first start from a restart.
+func OpenWithInfo(dsn string, opts ...Option) (*Sqlite3Store, OpenInfo, error) {
+	store, err := New(dsn, opts...)
+	if err != nil {
+		return nil, OpenInfo{}, err
+	}
+	info := OpenInfo{Created: store.created}
+	if info.ReadOnly, err = store.readOnly(); err != nil {
+		store.Close()
+		return nil, OpenInfo{}, err
+	}
+	if info.SchemaVersion, err = store.SchemaVersion(); err != nil {
+		store.Close()
+		return nil, OpenInfo{}, err
+	}
+	query := fmt.Sprintf("select count(*) from %s", dbLogs)
+	if err := store.reader().QueryRow(query).Scan(&info.LogCount); err != nil {
+		store.Close()
+		return nil, OpenInfo{}, err
+	}
+	return store, info, nil
+}
@@ -0,0 +1,52 @@
+package raftsqlite3
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestOpenWithInfo(t *testing.T) {
+	fh, err := ioutil.TempFile("", "sqlite3.db")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := fh.Name()
+	fh.Close()
+	os.Remove(path)
+	defer os.Remove(path)
+
+	store, info, err := raftsqlite3.OpenWithInfo(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !info.Created || info.ReadOnly || info.LogCount != 0 || info.SchemaVersion == 0 {
+		t.Fatalf("bad: %+v", info)
+	}
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	// A restart
+	store, info, err = raftsqlite3.OpenWithInfo(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if info.Created || info.ReadOnly || info.LogCount != 2 {
+		t.Fatalf("bad: %+v", info)
+	}
+	store.Close()
+
+	store, info, err = raftsqlite3.OpenWithInfo(path + "?_query_only=true")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if info.Created || !info.ReadOnly || info.LogCount != 2 {
+		t.Fatalf("bad: %+v", info)
+	}
+}
@@ -0,0 +1,750 @@
+package raftsqlite3
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Option configures a Sqlite3Store when it is opened.
+type Option func(*options)
+
+// options holds the settings applied by Option.
+type options struct {
+	// logger receives the store's diagnostic output.
+	logger *log.Logger
+	// slowLogThreshold is the duration above which an operation is logged,
+	// zero disables slow logging.
+	slowLogThreshold time.Duration
+	// termColumn stores the log term in an indexed column.
+	termColumn bool
+	// maxValueSize is the max size in bytes of a stored value, zero means unlimited.
+	maxValueSize int
+	// mmapSize is the mmap_size pragma of each connection, negative means
+	// the sqlite3 default.
+	mmapSize int64
+	// postCommitHook is called after StoreLogs commits.
+	postCommitHook func(first, last uint64)
+	// readBusyTimeout is the busy timeout of reads, zero means reads share
+	// the connections and busy timeout of writes.
+	readBusyTimeout time.Duration
+	// autoCheckpointInterval is the interval of the background checkpoints,
+	// zero disables them.
+	autoCheckpointInterval time.Duration
+	autoCheckpointMode     CheckpointMode
+	// fastImport makes Import drop the secondary indexes and not sync.
+	fastImport bool
+	// vfs is the name of the sqlite3 VFS to open the database with.
+	vfs string
+	// rejectBelowBase makes StoreLogs reject the logs at or below the base index.
+	rejectBelowBase bool
+	// splitData holds the log data in its own table.
+	splitData bool
+	// codec encodes the logs.
+	codec Codec
+	// fallbackCodec decodes the logs the codec fails to.
+	fallbackCodec Codec
+	// lagMissingAsZero makes LagBetween read missing keys as 0.
+	lagMissingAsZero bool
+	// confIndex adds the covering index of the conf table.
+	confIndex bool
+	// busyHandler decides whether to retry busy writes.
+	busyHandler func(count int) bool
+	// writeTimeout bounds the wait of the busy writes.
+	writeTimeout time.Duration
+	// transformEnc and transformDec transform the encoded logs.
+	transformEnc func([]byte) ([]byte, error)
+	transformDec func([]byte) ([]byte, error)
+	// walAutoCheckpoint is the wal_autocheckpoint pragma of each connection,
+	// negative means the sqlite3 default.
+	walAutoCheckpoint int
+	// connectInit are the statements run on each connection after the pragmas.
+	connectInit []string
+	// timestamps stores the store time of the logs in an indexed column.
+	timestamps bool
+	// sharedCache opens the connections in shared-cache mode.
+	sharedCache bool
+	// logKeyType is the type of the id column of the logs, "integer" or "text".
+	logKeyType string
+	// deferredCheckpoint defers the checkpoints until the writes are idle.
+	deferredCheckpoint bool
+	// immutable opens the database file read-only without locking it.
+	immutable bool
+	// deleteYield is the pause between the batches of DeleteRange.
+	deleteYield time.Duration
+	// preDestructiveBackupDir is the directory of the backups taken before
+	// the destructive methods, empty to take none.
+	preDestructiveBackupDir string
+	// confOrdering records the insertion order of the conf keys.
+	confOrdering bool
+	// commitMode is when the commits are synced.
+	commitMode CommitMode
+	// pageSize is the page size of a new database, zero means the sqlite3
+	// default.
+	pageSize int
+	// journalMode is the journal mode taken from the data source name to be
+	// set after the page size.
+	journalMode string
+	// partition extracts the partition of each log stored in an indexed
+	// column, nil for none.
+	partition func(*raft.Log) int64
+	// maxDiskBytes is the max bytes of the database pages in use, zero
+	// means unlimited.
+	maxDiskBytes int64
+	// image is the database image of NewFromBytes.
+	image []byte
+	// retryClassifier decides which errors besides the busy ones to retry.
+	retryClassifier func(error) bool
+	// readFallback is the store read on a miss, nil for none.
+	readFallback raft.LogStore
+	// statementTimeout bounds each operation, zero means unbounded.
+	statementTimeout time.Duration
+	// onRetry is called before each retry of a write.
+	onRetry func(op string, attempt int, err error)
+	// inClauseLimit is the max number of indexes of an "id in" list.
+	inClauseLimit int
+	// typeColumn stores the log type in an indexed column.
+	typeColumn bool
+	// repanic panics again after rolling back a panicking transaction.
+	repanic bool
+	// openTimeout bounds the writes made by New.
+	openTimeout time.Duration
+	// mirror is the store the writes are mirrored to.
+	mirror *Sqlite3Store
+	// rejectIndexZero makes StoreLogs reject the logs at index 0.
+	rejectIndexZero bool
+	// checkpointEveryN is the number of stored logs between the checkpoints.
+	checkpointEveryN uint64
+	// walSizeLimit is the size of the WAL file that StoreLogs truncates.
+	walSizeLimit int64
+	// compressor compresses the log values of compressMinSize bytes or more.
+	compressor      Compressor
+	compressMinSize int
+	// maxConcurrentReads bounds the reads running at once.
+	maxConcurrentReads int
+	// writeRateLimit is the throughput of the logs stored in bytes per second.
+	writeRateLimit int
+}
+
+func defaultOptions() *options {
+	return &options{
+		logger:            log.New(os.Stderr, "", log.LstdFlags),
+		mmapSize:          -1,
+		walAutoCheckpoint: -1,
+		codec:             MsgpackCodec{},
+		logKeyType:        "integer",
+		inClauseLimit:     999,
+	}
+}
+
+// validate checks the options are coherent.
+func (o *options) validate() error {
+	if o.vfs != "" && strings.ContainsAny(o.vfs, "?&=#/ \t") {
+		return fmt.Errorf("invalid vfs name %q", o.vfs)
+	}
+	if o.logKeyType != "integer" && o.logKeyType != "text" {
+		return fmt.Errorf("invalid log key type %q", o.logKeyType)
+	}
+	if o.pageSize != 0 && (o.pageSize < 512 || o.pageSize > 65536 || o.pageSize&(o.pageSize-1) != 0) {
+		return fmt.Errorf("invalid page size %d, a power of two from 512 to 65536", o.pageSize)
+	}
+	if o.compressMinSize < 0 {
+		return fmt.Errorf("invalid compression min size %d", o.compressMinSize)
+	}
+	if o.maxConcurrentReads < 0 {
+		return fmt.Errorf("invalid max concurrent reads %d", o.maxConcurrentReads)
+	}
+	if o.writeRateLimit < 0 {
+		return fmt.Errorf("invalid write rate limit %d", o.writeRateLimit)
+	}
+	if o.inClauseLimit < 1 {
+		return fmt.Errorf("invalid in clause limit %d", o.inClauseLimit)
+	}
+	switch o.commitMode {
+	case CommitDefault, CommitImmediate, CommitGroup:
+	default:
+		return fmt.Errorf("invalid commit mode %d", int(o.commitMode))
+	}
+	for _, stmt := range o.connectInit {
+		fields := strings.Fields(stmt)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "pragma") {
+			return fmt.Errorf("invalid connect init statement %q, only pragmas are allowed", stmt)
+		}
+	}
+	return nil
+}
+
+// pragmas returns the statements run on each new connection.
+func (o *options) pragmas() []string {
+	var pragmas []string
+	// The page size of a new database is fixed once the journal mode is WAL
+	if o.pageSize > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("pragma page_size = %d", o.pageSize))
+	}
+	if o.journalMode != "" {
+		pragmas = append(pragmas, fmt.Sprintf("pragma journal_mode = %s", o.journalMode))
+	}
+	if o.mmapSize >= 0 {
+		pragmas = append(pragmas, fmt.Sprintf("pragma mmap_size = %d", o.mmapSize))
+	}
+	if o.deferredCheckpoint {
+		pragmas = append(pragmas, "pragma wal_autocheckpoint = 0")
+	} else if o.walAutoCheckpoint >= 0 {
+		pragmas = append(pragmas, fmt.Sprintf("pragma wal_autocheckpoint = %d", o.walAutoCheckpoint))
+	}
+	if sync := o.commitMode.synchronous(); sync != "" {
+		pragmas = append(pragmas, fmt.Sprintf("pragma synchronous = %s", sync))
+	}
+	pragmas = append(pragmas, o.connectInit...)
+	return pragmas
+}
+
+// WithLogger sets the logger used by the store, defaults to a logger
+// writing to stderr.
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithSlowLogThreshold logs the operations that take longer than d, with
+// their name, duration and sizes. Zero disables it.
+func WithSlowLogThreshold(d time.Duration) Option {
+	return func(o *options) {
+		o.slowLogThreshold = d
+	}
+}
+
+// WithTermColumn stores the term of each log in an indexed column of the
+// logs table, which GetLogsByTerm requires. Logs stored before the column
+// existed are filled in when the store is opened.
+func WithTermColumn() Option {
+	return func(o *options) {
+		o.termColumn = true
+	}
+}
+
+// WithMaxValueSize makes StoreLogs and Set return ErrValueTooLarge when an
+// encoded value exceeds bytes. Zero, the default, means unlimited.
+func WithMaxValueSize(bytes int) Option {
+	return func(o *options) {
+		o.maxValueSize = bytes
+	}
+}
+
+// WithMmapSize sets the mmap_size pragma on each connection, so reads go
+// through memory-mapped I/O up to bytes of the file. It is applied to
+// read-only stores as well, e.g. combined with "_query_only=true" for fast scans.
+func WithMmapSize(bytes int64) Option {
+	return func(o *options) {
+		o.mmapSize = bytes
+	}
+}
+
+// WithPostCommitHook calls hook with the index range written after each
+// successful StoreLogs commit. A panic in the hook is logged and doesn't undo
+// the committed logs.
+func WithPostCommitHook(hook func(first, last uint64)) Option {
+	return func(o *options) {
+		o.postCommitHook = hook
+	}
+}
+
+// WithReadBusyTimeout gives reads their own connections whose busy timeout
+// is d, separate from the "_busy_timeout" of the data source name used by
+// writes. A read that meets a lock, e.g. while a writer checkpoints, then
+// waits up to d rather than failing with "database is locked". Zero, the
+// default, keeps reads on the write connections.
+func WithReadBusyTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readBusyTimeout = d
+	}
+}
+
+// WithAutoCheckpoint checkpoints the WAL in mode every interval in the
+// background until the store is closed, so that the WAL stays bounded
+// without checkpoints scheduled by the application. Zero disables it.
+func WithAutoCheckpoint(interval time.Duration, mode CheckpointMode) Option {
+	return func(o *options) {
+		o.autoCheckpointInterval = interval
+		o.autoCheckpointMode = mode
+	}
+}
+
+// WithFastImport makes Import drop the secondary indexes of the logs table
+// while it inserts, recreating them at the end, and turn off syncing for the
+// duration of the import. A crash during the import may lose the imported logs.
+func WithFastImport() Option {
+	return func(o *options) {
+		o.fastImport = true
+	}
+}
+
+// WithVFS opens the database with the sqlite3 VFS registered under name,
+// e.g. an in-memory or networked VFS. Opening fails with ErrVFSNotRegistered
+// if no such VFS is registered.
+func WithVFS(name string) Option {
+	return func(o *options) {
+		o.vfs = name
+	}
+}
+
+// WithRejectBelowBase makes StoreLogs return ErrBelowBase if any log index is
+// at or below the base index, i.e. was already compacted away. It guards
+// against re-storing compacted logs.
+func WithRejectBelowBase() Option {
+	return func(o *options) {
+		o.rejectBelowBase = true
+	}
+}
+
+// WithSplitData holds the log data in the log_data table keyed by index,
+// apart from the rest of the log in the logs table, so that reading the
+// logs table doesn't pull large payloads. GetLog joins both. Once a store
+// holds split data it must always be opened with this option.
+func WithSplitData() Option {
+	return func(o *options) {
+		o.splitData = true
+	}
+}
+
+// WithCodec sets the codec of the logs, defaults to MsgpackCodec.
+func WithCodec(c Codec) Option {
+	return func(o *options) {
+		if c != nil {
+			o.codec = c
+		}
+	}
+}
+
+// WithFallbackCodec decodes the logs the codec fails to decode with old,
+// e.g. the codec used before switching to a new one with WithCodec. New logs
+// are always encoded with the codec, and RecodeAll rewrites the old ones.
+func WithFallbackCodec(old Codec) Option {
+	return func(o *options) {
+		o.fallbackCodec = old
+	}
+}
+
+// WithLagMissingAsZero makes LagBetween read a missing key as 0 instead of
+// returning ErrKeyNotFound.
+func WithLagMissingAsZero() Option {
+	return func(o *options) {
+		o.lagMissingAsZero = true
+	}
+}
+
+// WithConfIndex adds a covering index on the keys and values of the conf
+// table, so that RangePrefix reads the index only. The index is dropped when
+// the store is opened writable without this option.
+func WithConfIndex() Option {
+	return func(o *options) {
+		o.confIndex = true
+	}
+}
+
+// WithBusyHandler replaces the fixed sleep before retrying the writes that
+// failed with a busy or locked error. The handler is called with the number
+// of retries so far, and returns true to retry at once or false to return
+// the error; it may sleep before returning. go-sqlite3 has no busy handler
+// hook, so the handler runs after the busy timeout of the data source name
+// expired: open with "_busy_timeout=0" to leave it all to the handler.
+func WithBusyHandler(handler func(count int) bool) Option {
+	return func(o *options) {
+		o.busyHandler = handler
+	}
+}
+
+// WithWriteTimeout bounds how long a write waits for the locks held by other
+// connections, replacing the busy timeout of the data source name.
+//
+// Waiting on a lock happens in two layers. Within an attempt, the driver
+// retries the statement until the busy timeout, set to d, expires. Then the
+// store retries the failed attempt after a sleep, which without this option
+// happens until the attempt succeeds. With this option no retry starts once
+// d elapsed since the write started, and the sleeps don't go past d, so a
+// contended write fails with the busy error after about d: an attempt that
+// waited out the busy timeout is never retried. Only a retry of an attempt
+// that failed without waiting, started right before d, can exceed d, by the
+// busy timeout at most.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithValueTransformer transforms the stored log values, e.g. to redact
+// them: enc is applied to the output of the codec on stores, and dec to the
+// stored values before the codec decodes them on reads, so dec must reverse
+// enc. With WithSplitData the log data held apart is transformed the same
+// way. With WithCompression, a value is encoded by the codec, then compressed,
+// then transformed by enc on stores, and the reverse on reads: dec, then
+// decompression, then the codec, so that e.g. an encryption in enc sees the
+// compressed value. The fallback codec decodes the output of dec too.
+func WithValueTransformer(enc, dec func([]byte) ([]byte, error)) Option {
+	return func(o *options) {
+		o.transformEnc, o.transformDec = enc, dec
+	}
+}
+
+// WithWALAutoCheckpoint sets the wal_autocheckpoint pragma on each
+// connection, so that a commit checkpoints once the WAL holds pages pages,
+// 1000 by default. 0 disables the checkpoints on commit, e.g. to leave them to
+// WithAutoCheckpoint.
+func WithWALAutoCheckpoint(pages int) Option {
+	return func(o *options) {
+		o.walAutoCheckpoint = pages
+	}
+}
+
+// WithConnectInit runs the ";" separated pragmas of script on every new
+// connection, after the pragmas of the other options, e.g.
+// "pragma temp_store = memory; pragma cache_spill = off". It runs each time
+// the pool opens a connection, read connections included. New fails if
+// script holds anything but pragmas.
+func WithConnectInit(script string) Option {
+	return func(o *options) {
+		o.connectInit = nil
+		for _, stmt := range strings.Split(script, ";") {
+			if stmt = strings.TrimSpace(stmt); stmt != "" {
+				o.connectInit = append(o.connectInit, stmt)
+			}
+		}
+	}
+}
+
+// WithTimestamps stores the time each log is stored at in the indexed
+// stored_at column of the logs table, in nanoseconds since the Unix epoch,
+// for the time based methods such as GrowthSince. The logs stored before the
+// option was used have no time.
+func WithTimestamps() Option {
+	return func(o *options) {
+		o.timestamps = true
+	}
+}
+
+// WithSharedCache opens the connections of the store in SQLite shared-cache
+// mode, turning a plain path data source name into a file: URI. The
+// connections of the process to the same database file, e.g. of the read
+// pool or of several stores on the file, then share one page cache. The
+// cache isn't shared across database files, so it doesn't help stores each
+// on its own file.
+//
+// Shared-cache connections lock each other at the table level: they fail at
+// once with a locked error instead of waiting for the busy timeout. The store
+// retries the locked writes like the busy ones, but the reads fail while
+// another connection of the cache writes the table, and SQLite discourages
+// this mode, see https://www.sqlite.org/sharedcache.html.
+func WithSharedCache() Option {
+	return func(o *options) {
+		o.sharedCache = true
+	}
+}
+
+// WithLogKeyType sets the type of the id column of the logs table when it's
+// created, "integer" by default or "text", which stores the indexes as 20
+// digit zero-padded decimals so that they sort lexicographically, e.g. for
+// the tools reading the database. The store can't be reopened with another
+// type.
+func WithLogKeyType(typ string) Option {
+	return func(o *options) {
+		o.logKeyType = strings.ToLower(typ)
+	}
+}
+
+// WithDeferredCheckpoint disables the checkpoints on commit, so that they
+// don't contend with the writes of a burst, and truncates the WAL with a
+// single checkpoint once no write happened for a second. It overrides
+// WithWALAutoCheckpoint. The WAL grows as long as the writes don't pause.
+func WithDeferredCheckpoint() Option {
+	return func(o *options) {
+		o.deferredCheckpoint = true
+	}
+}
+
+// WithImmutable opens the store read-only with the immutable=1 URI parameter,
+// turning a plain path data source name into a file: URI, so that sqlite3
+// neither locks the database file nor creates the -shm file. It works
+// without write access to the directory, e.g. for an inspection tool. The
+// WAL is ignored, as with WithIgnoreWAL. Changes of the file while the store
+// is open may be read as corruption.
+func WithImmutable() Option {
+	return func(o *options) {
+		o.immutable = true
+	}
+}
+
+// WithIgnoreWAL opens the store on the database file alone, ignoring its -wal
+// file, e.g. to compare the logs before and after the WAL of a copied
+// database during an investigation. The store sees the database file as of
+// its last checkpoint: the commits still only in the WAL are invisible, and
+// the WAL is neither replayed nor changed, so that opening the store again
+// without the option recovers them. It's read-only and doesn't lock, as it
+// opens the store like WithImmutable, so the file must not be written
+// meanwhile.
+func WithIgnoreWAL() Option {
+	return func(o *options) {
+		o.immutable = true
+	}
+}
+
+// WithDeleteYield makes DeleteRange pause for d between its batches of 999
+// logs, each committed on its own, so that the readers and checkpoints
+// proceed during a large compaction. It's 0 by default, no pause.
+func WithDeleteYield(d time.Duration) Option {
+	return func(o *options) {
+		o.deleteYield = d
+	}
+}
+
+// WithPreDestructiveBackup makes DeleteAll and Vacuum first Backup the store
+// into a timestamped file of dir, whose path they return, and abort without
+// change if the backup fails. dir must exist, and the backups are never
+// removed by the store.
+func WithPreDestructiveBackup(dir string) Option {
+	return func(o *options) {
+		o.preDestructiveBackupDir = dir
+	}
+}
+
+// WithConfOrdering records the insertion order of the conf keys in the
+// indexed seq column of the conf table, which RangeOrdered iterates by. A key
+// set again keeps its place. The keys present when the option is first used
+// are ordered as they're laid out in the table, and the keys set while the
+// store is opened without the option lose their place.
+func WithConfOrdering() Option {
+	return func(o *options) {
+		o.confOrdering = true
+	}
+}
+
+// WithCommitMode sets when the commits are synced to disk, CommitDefault by
+// default. With CommitGroup many small StoreLogs share one sync, made by
+// FlushCommits where the caller needs them durable, or by the next checkpoint.
+func WithCommitMode(mode CommitMode) Option {
+	return func(o *options) {
+		o.commitMode = mode
+	}
+}
+
+// WithPageSize sets the page size in bytes of a new database, a power of two
+// from 512 to 65536. The page size of an existing database can't change:
+// New fails with ErrSchemaMismatch if it differs from bytes.
+func WithPageSize(bytes int) Option {
+	return func(o *options) {
+		o.pageSize = bytes
+	}
+}
+
+// WithPartitionColumn stores the partition extractor returns for each log in
+// an indexed column of the logs table, which GetLogsByPartition requires,
+// e.g. the id of one of the streams multiplexed into the log. Logs stored
+// before the column existed are filled in when the store is opened.
+func WithPartitionColumn(extractor func(*raft.Log) int64) Option {
+	return func(o *options) {
+		o.partition = extractor
+	}
+}
+
+// WithMaxDiskBytes bounds the database size, for a disk of bounded size: after
+// each store of logs, the oldest logs are deleted 100 at a time with
+// DeleteRange, while the database pages in use exceed bytes. The last log
+// is always kept. The pages of the deleted logs are reused by the next
+// writes; they're released to the file system only if the database was
+// created in incremental auto-vacuum mode, e.g. with "_auto_vacuum=incremental".
+//
+// The deleted logs are lost whether or not they were replicated or applied:
+// a follower lagging behind them needs a snapshot, and the logs not covered
+// by a snapshot yet are gone for good. Zero, the default, means unlimited.
+func WithMaxDiskBytes(bytes int64) Option {
+	return func(o *options) {
+		o.maxDiskBytes = bytes
+	}
+}
+
+// WithRetryClassifier retries the writes that failed with an error for which
+// classifier returns true like the ones that failed with a busy or locked
+// error, which are always retried, e.g. the transient errors of a networked
+// VFS. The retries follow the busy handler and the write timeout alike.
+func WithRetryClassifier(classifier func(error) bool) Option {
+	return func(o *options) {
+		o.retryClassifier = classifier
+	}
+}
+
+// WithReadFallback makes GetLog read the logs missing from the store from
+// fb, and GetLogRange the ones below the first index of the store, e.g. the
+// store being migrated from while the new logs are stored in this one. The writes never go to fb, and FirstIndex and LastIndex
+// only see the logs of this store.
+func WithReadFallback(fb raft.LogStore) Option {
+	return func(o *options) {
+		o.readFallback = fb
+	}
+}
+
+// WithStatementTimeout bounds the time each read and write of the logs and
+// of the conf takes, beyond the wait for the locks bounded by the busy
+// timeout: the statements running at the deadline are interrupted, and the
+// operation fails with ErrStatementTimeout, e.g. a GetLogRange over a huge
+// range. A retried write gets the timeout for each attempt, and RecodeAll
+// for each of its batches. The iterations calling back for each row, i.e.
+// IterateLogs, IterateLogsReverse, StreamLogs and RangeOrdered, aren't
+// bounded, as their time mostly depends on the callbacks: StreamLogs is
+// bounded by its context instead. Zero, the default, means unbounded.
+func WithStatementTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.statementTimeout = d
+	}
+}
+
+// WithOnRetry calls fn each time a write is retried after a busy error, or
+// one of WithRetryClassifier, with the operation, e.g. "StoreLogs", the
+// number of the retry counted from 1, and the error, e.g. to count the lock
+// contention. It's called before the sleep preceding the retry, or after the
+// busy handler of WithBusyHandler decided to retry. fn must not block.
+func WithOnRetry(fn func(op string, attempt int, err error)) Option {
+	return func(o *options) {
+		o.onRetry = fn
+	}
+}
+
+// WithInClauseLimit sets the max number of indexes GetLogs queries at once in
+// an "id in (...)" list, 999 by default, the lowest max number of variables of
+// a statement, SQLITE_MAX_VARIABLE_NUMBER, of the sqlite3 builds. A build
+// allowing more, such as the default of recent versions, takes fewer queries
+// with a higher limit.
+func WithInClauseLimit(n int) Option {
+	return func(o *options) {
+		o.inClauseLimit = n
+	}
+}
+
+// WithTypeColumn stores the type of each log in an indexed column of the logs
+// table, which GetLogsByType requires. Logs stored before the column existed
+// are filled in when the store is opened.
+func WithTypeColumn() Option {
+	return func(o *options) {
+		o.typeColumn = true
+	}
+}
+
+// WithRepanic makes a panic in the transactions of StoreLogs and of the
+// initialization, e.g. in a codec, propagate once the transaction is rolled
+// back, for development. By default the panic is turned into an ErrPanic
+// error holding the recovered value and the stack of the panic.
+func WithRepanic() Option {
+	return func(o *options) {
+		o.repanic = true
+	}
+}
+
+// WithOpenTimeout bounds the writes made by New, i.e. the initialization of
+// the tables, the clean shutdown flag and the msgpack format version, retried
+// while another connection writes, e.g. when several processes start
+// together on the same database. New fails with ErrOpenTimeout once d
+// elapsed. Zero, the default, retries until the writes succeed.
+func WithOpenTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.openTimeout = d
+	}
+}
+
+// WithMirror applies the writes of StoreLogs, StoreLogsIfAbsent, AppendLog,
+// DeleteRange, Set and IncrementUint64 to the store m too, e.g. a hot standby
+// on another disk. The mirror write is done before the write commits, so
+// that a failed mirror write fails the write with ErrMirror and rolls it
+// back. Reads come only from this store. The mirroring is best-effort
+// synchronous: a write whose commit fails once mirrored is left in the
+// mirror, and the other writes, e.g. RecodeAll or RestoreFrom, aren't
+// mirrored. It doesn't replace the replication of Raft. m must be another
+// store, opened on another database, and it isn't closed with this store.
+func WithMirror(m *Sqlite3Store) Option {
+	return func(o *options) {
+		o.mirror = m
+	}
+}
+
+// WithRejectIndexZero makes StoreLogs, StoreLogsIfAbsent and AppendLog return
+// ErrZeroIndex for a batch holding a log at index 0, storing none, as Raft
+// indexes start at 1. Without it such a log is stored and read back by
+// GetLog, but FirstIndex skips it and LastIndex returns 0 when it's the only
+// log, so that 0 still stands for an empty log.
+func WithRejectIndexZero() Option {
+	return func(o *options) {
+		o.rejectIndexZero = true
+	}
+}
+
+// WithCheckpointEveryN runs a full checkpoint once n logs were stored since
+// the last checkpoint of the store, after the write that reached n, so that
+// the logs are in the database file at most every n logs: a middle ground
+// between a sync on every commit and WithAutoCheckpoint. Any checkpoint of
+// the store that completes restarts the count; a busy one is logged and
+// retried after the next write. Zero, the default, disables it.
+func WithCheckpointEveryN(n uint64) Option {
+	return func(o *options) {
+		o.checkpointEveryN = n
+	}
+}
+
+// WithWALSizeLimit bounds the size of the WAL file: once it reached bytes,
+// StoreLogs, StoreLogsIfAbsent and AppendLog truncate the WAL with a
+// TruncateWAL checkpoint before writing, and fail with ErrCheckpointBusy if
+// the readers hold the WAL past the busy timeout. The WAL still exceeds bytes
+// by the size of the write that reaches it. The write that triggers the
+// checkpoint waits for it, which copies the whole WAL into the database and
+// syncs it, and for the readers: expect a latency spike of the order of a
+// full checkpoint every bytes written. Zero, the default, disables it.
+func WithWALSizeLimit(bytes int64) Option {
+	return func(o *options) {
+		o.walSizeLimit = bytes
+	}
+}
+
+// WithCompression compresses the encoded log values, and the log data held
+// apart WithSplitData, of minSize bytes or more with c, e.g. a
+// FlateCompressor, before the value transformer. The smaller ones, which
+// compress poorly, are stored as is. Each value is prefixed with a flag byte
+// telling whether it's compressed, so that both kinds decode, and the logs
+// stored without compression can't be read anymore: once a store holds logs
+// stored WithCompression, it must always be opened with it.
+func WithCompression(c Compressor, minSize int) Option {
+	return func(o *options) {
+		o.compressor, o.compressMinSize = c, minSize
+	}
+}
+
+// WithMaxConcurrentReads bounds the reads running at once to n, the next
+// ones waiting for a slot, so that bursts of reads such as GetLogRange scans
+// queue instead of taking all the connections of the pool from the writer.
+// The reads of the LogStore and StableStore, GetLogRange, GetLogs, the
+// GetLogsBy methods, HasLog, IsEmpty, PresentRanges, RangeChecksum and the
+// cursors of StreamLogs and IterateLogs are bounded; the statistics and
+// maintenance reads aren't. A cursor holds its slot while the callbacks run,
+// so a callback reading the store needs another slot: with n = 1 it blocks
+// forever. Zero, the default, leaves them unbounded. Stats reports the reads
+// in flight either way.
+func WithMaxConcurrentReads(n int) Option {
+	return func(o *options) {
+		o.maxConcurrentReads = n
+	}
+}
+
+// WithWriteRateLimit throttles StoreLogs, StoreLogsIfAbsent and AppendLog to
+// bytesPerSec of encoded log values and data on average, e.g. to share a disk
+// with other tenants. A token bucket holding up to a second of bytes takes
+// the bytes of each write once committed, and a write waits before starting
+// while the bucket is in debt: a large batch goes through at once, and the
+// next writes wait for it to be paid. This intentionally adds latency to the
+// writes past the rate. Zero, the default, disables it.
+func WithWriteRateLimit(bytesPerSec int) Option {
+	return func(o *options) {
+		o.writeRateLimit = bytesPerSec
+	}
+}
@@ -0,0 +1,88 @@
+package raftsqlite3
+
+import (
+	"fmt"
+)
+
+// preallocateChunk is the max size of the blobs Preallocate grows the database
+// with, below the max length of a sqlite3 value.
+const preallocateChunk = 64 << 20
+
+// Preallocate grows the database file to at least bytes, so that the pages of
+// the next writes are taken from the free pages instead of growing the file
+// page by page, which fragments it on some file systems. It writes zero
+// blobs into a scratch table dropped in the same transaction, then truncates
+// the WAL so that the file reaches the size: the WAL temporarily grows by the
+// same amount. As sqlite3 doesn't write the freed pages, the checkpoint grows
+// the file with a truncation, leaving holes. On Linux, Preallocate then
+// allocates the blocks of the file with fallocate, unless the file system
+// doesn't support it. On the other platforms the file system decides: the
+// file stays sparse on most Unix file systems, while Windows allocates the
+// space of the grown file. It has no effect in full auto-vacuum mode, which
+// releases the free pages on commit, and a VACUUM shrinks the file back.
+func (s *Sqlite3Store) Preallocate(bytes int64) error {
+	grown, err := s.preallocate(bytes)
+	if err != nil || !grown {
+		return err
+	}
+	if err := s.TruncateWAL(); err != nil {
+		return err
+	}
+	if main, _, _ := s.Files(); main != "" {
+		return allocateFile(main, bytes)
+	}
+	return nil
+}
+
+// preallocate grows the database to at least bytes, and reports whether it
+// had to.
+func (s *Sqlite3Store) preallocate(bytes int64) (grown bool, err error) {
+	if err = s.beginWrite(); err != nil {
+		return false, err
+	}
+	defer s.endWrite()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	var pages, size int64
+	if err := s.db.QueryRow("pragma page_count").Scan(&pages); err != nil {
+		return false, err
+	}
+	if err := s.db.QueryRow("pragma page_size").Scan(&size); err != nil {
+		return false, err
+	}
+	missing := bytes - pages*size
+	if missing <= 0 {
+		return false, nil
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	const table = "raftsqlite3_preallocate"
+	if _, err = tx.Exec(fmt.Sprintf("create table %s(b blob)", table)); err != nil {
+		return false, err
+	}
+	query := fmt.Sprintf("insert into %s(b)values(zeroblob(?))", table)
+	for missing > 0 {
+		n := missing
+		if n > preallocateChunk {
+			n = preallocateChunk
+		}
+		if _, err = tx.Exec(query, n); err != nil {
+			return false, err
+		}
+		missing -= n
+	}
+	if _, err = tx.Exec(fmt.Sprintf("drop table %s", table)); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,31 @@
+//go:build linux
+// +build linux
+
+package raftsqlite3
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is the FALLOC_FL_KEEP_SIZE mode of fallocate, which
+// allocates the blocks without changing the size of the file.
+const fallocKeepSize = 0x01
+
+// allocateFile allocates the blocks of the first bytes of the file at path,
+// e.g. the holes left when sqlite3 grows the file by truncating it. The
+// content of the file and its size are kept. The file systems that don't
+// support fallocate keep the file as is.
+func allocateFile(path string, bytes int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = syscall.Fallocate(int(f.Fd()), fallocKeepSize, 0, bytes)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+//go:build linux
+// +build linux
+
+package raftsqlite3
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestSqlite3Store_Preallocate_Blocks(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	const size = 4 << 20
+	if err := store.Preallocate(size); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The space is allocated, not a hole
+	if allocated := fi.Sys().(*syscall.Stat_t).Blocks * 512; allocated < size {
+		t.Fatalf("bad: %d bytes allocated", allocated)
+	}
+}
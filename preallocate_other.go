@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package raftsqlite3
+
+// allocateFile keeps the file as is outside of Linux, the file system
+// deciding whether the space grown by sqlite3 is allocated.
+func allocateFile(path string, bytes int64) error {
+	return nil
+}
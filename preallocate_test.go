@@ -0,0 +1,37 @@
+package raftsqlite3
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestSqlite3Store_Preallocate(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	const size = 4 << 20
+	if err := store.Preallocate(size); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Size() < size {
+		t.Fatalf("bad: %d", fi.Size())
+	}
+
+	// The space is reused, and already there
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Preallocate(size); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi2, err := os.Stat(path); err != nil || fi2.Size() != fi.Size() {
+		t.Fatalf("bad: %v, %v", fi2, err)
+	}
+}
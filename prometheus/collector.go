@@ -0,0 +1,68 @@
+// Package prometheus exports the stats of a raftsqlite3 store as Prometheus
+// metrics, apart from the core package to keep it free of the dependency.
+package prometheus
+
+import (
+	"github.com/little-pan/raft-sqlite3"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "raftsqlite3"
+
+// Collector implements prometheus.Collector for a store, it reads the store
+// Stats on each collect.
+type Collector struct {
+	store *raftsqlite3.Sqlite3Store
+
+	logCount    *prom.Desc
+	firstIndex  *prom.Desc
+	lastIndex   *prom.Desc
+	dbSize      *prom.Desc
+	walSize     *prom.Desc
+	busyRetries *prom.Desc
+}
+
+// NewCollector returns a collector for the store, the labels tell apart the
+// stores registered together and can be nil.
+func NewCollector(store *raftsqlite3.Sqlite3Store, labels prom.Labels) *Collector {
+	desc := func(name, help string) *prom.Desc {
+		return prom.NewDesc(prom.BuildFQName(namespace, "", name), help, nil, labels)
+	}
+	return &Collector{
+		store:       store,
+		logCount:    desc("log_count", "Number of logs in the store."),
+		firstIndex:  desc("first_index", "First index of the log, 0 if empty."),
+		lastIndex:   desc("last_index", "Last index of the log, 0 if empty."),
+		dbSize:      desc("db_size_bytes", "Size of the database file in bytes."),
+		walSize:     desc("wal_size_bytes", "Size of the WAL file in bytes."),
+		busyRetries: desc("busy_retries_total", "Writes retried on a busy database."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.logCount
+	ch <- c.firstIndex
+	ch <- c.lastIndex
+	ch <- c.dbSize
+	ch <- c.walSize
+	ch <- c.busyRetries
+}
+
+// Collect implements prometheus.Collector, each metric is invalid when the
+// stats can't be read.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	st, err := c.store.Stats()
+	if err != nil {
+		for _, d := range []*prom.Desc{c.logCount, c.firstIndex, c.lastIndex, c.dbSize, c.walSize, c.busyRetries} {
+			ch <- prom.NewInvalidMetric(d, err)
+		}
+		return
+	}
+	ch <- prom.MustNewConstMetric(c.logCount, prom.GaugeValue, float64(st.LogCount))
+	ch <- prom.MustNewConstMetric(c.firstIndex, prom.GaugeValue, float64(st.FirstIndex))
+	ch <- prom.MustNewConstMetric(c.lastIndex, prom.GaugeValue, float64(st.LastIndex))
+	ch <- prom.MustNewConstMetric(c.dbSize, prom.GaugeValue, float64(st.DBSize))
+	ch <- prom.MustNewConstMetric(c.walSize, prom.GaugeValue, float64(st.WALSize))
+	ch <- prom.MustNewConstMetric(c.busyRetries, prom.CounterValue, float64(st.BusyRetries))
+}
@@ -0,0 +1,61 @@
+package prometheus
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	fh, err := ioutil.TempFile("", "sqlite3.db")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.Remove(fh.Name())
+	defer os.Remove(fh.Name())
+	store, err := raftsqlite3.New(fh.Name())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+
+	logs := []*raft.Log{{Index: 1, Data: []byte("log1")}, {Index: 2, Data: []byte("log2")}}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	reg := prom.NewRegistry()
+	if err := reg.Register(NewCollector(store, prom.Labels{"store": "test"})); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	values := make(map[string]float64)
+	for _, f := range families {
+		m := f.GetMetric()[0]
+		if m.GetLabel()[0].GetValue() != "test" {
+			t.Fatalf("bad: %v", m)
+		}
+		if m.Gauge != nil {
+			values[f.GetName()] = m.GetGauge().GetValue()
+		} else {
+			values[f.GetName()] = m.GetCounter().GetValue()
+		}
+	}
+	if len(values) != 6 {
+		t.Fatalf("bad: %v", values)
+	}
+	if values["raftsqlite3_log_count"] != 2 || values["raftsqlite3_first_index"] != 1 ||
+		values["raftsqlite3_last_index"] != 2 || values["raftsqlite3_busy_retries_total"] != 0 {
+		t.Fatalf("bad: %v", values)
+	}
+	if values["raftsqlite3_db_size_bytes"] <= 0 || values["raftsqlite3_wal_size_bytes"] <= 0 {
+		t.Fatalf("bad: %v", values)
+	}
+}
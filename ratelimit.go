@@ -0,0 +1,55 @@
+package raftsqlite3
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket of bytes, refilled at rate bytes per second
+// up to a second of them. The writes take their bytes once done, which can
+// leave the bucket in debt, and the next writes wait until it's paid.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec int) *rateLimiter {
+	rate := float64(bytesPerSec)
+	return &rateLimiter{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// refill adds the tokens accrued since the last refill, l.mu being held.
+func (l *rateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+}
+
+// wait waits until the bucket is out of debt, if l isn't nil.
+func (l *rateLimiter) wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.refill(time.Now())
+	d := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// take takes n bytes from the bucket, if l isn't nil.
+func (l *rateLimiter) take(n int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+}
@@ -0,0 +1,178 @@
+package raftsqlite3
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// Rebuild rewrites the database into a new file of newPageSize bytes pages,
+// as the page size of a database in WAL mode can't change in place, then
+// swaps the files and reopens the store on the new one. The schema, the
+// logs, the conf and the schema version are copied as they are, and the
+// copy is checked for integrity before the swap, done by a rename.
+//
+// The store must not be used by other goroutines or processes during the
+// rebuild, which closes and reopens its connections: it truncates the WAL
+// first, and returns ErrCheckpointBusy if another connection reads it. It
+// returns ErrNotSupported for an in-memory store.
+func (s *Sqlite3Store) Rebuild(newPageSize int) error {
+	if newPageSize < 512 || newPageSize > 65536 || newPageSize&(newPageSize-1) != 0 {
+		return fmt.Errorf("invalid page size %d, a power of two from 512 to 65536", newPageSize)
+	}
+	main, wal, shm := s.Files()
+	if main == "" || s.opts.image != nil {
+		return ErrNotSupported
+	}
+	if err := s.TruncateWAL(); err != nil {
+		return err
+	}
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	tmp := main + ".rebuild"
+	if err := removeFiles(tmp, tmp+"-wal", tmp+"-shm"); err != nil {
+		return err
+	}
+	if err := rebuildInto(tmp, main, newPageSize); err != nil {
+		removeFiles(tmp, tmp+"-wal", tmp+"-shm")
+		return fmt.Errorf("rebuild: %w", err)
+	}
+
+	// Swap the files once all the connections are closed, reopening the
+	// original database if the swap fails
+	if s.rdb != nil {
+		s.rdb.Close()
+	}
+	if err := s.db.Close(); err != nil {
+		s.reopen()
+		removeFiles(tmp, tmp+"-wal", tmp+"-shm")
+		return err
+	}
+	err := removeFiles(wal, shm)
+	if err == nil {
+		err = os.Rename(tmp, main)
+	}
+	if err != nil {
+		s.reopen()
+		removeFiles(tmp, tmp+"-wal", tmp+"-shm")
+		return fmt.Errorf("rebuild: %w", err)
+	}
+	removeFiles(tmp+"-wal", tmp+"-shm")
+	s.logger.Printf("[INFO ] %s: rebuilt %s with %d bytes pages", tag, main, newPageSize)
+
+	s.opts.pageSize = newPageSize
+	s.reopen()
+	return s.checkPageSize()
+}
+
+// reopen opens the connections of the store again on its data source name.
+func (s *Sqlite3Store) reopen() {
+	s.db = sql.OpenDB(newConnector(s.dsn, s.opts))
+	if s.rdb != nil {
+		s.rdb = sql.OpenDB(newReadConnector(s.dsn, s.opts))
+	}
+}
+
+// removeFiles removes the files at paths that exist.
+func removeFiles(paths ...string) error {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildInto creates the database at path with pages of pageSize bytes, and
+// copies into it the schema and the rows of the database at src.
+func rebuildInto(path, src string, pageSize int) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// The attached database belongs to the connection
+	db.SetMaxOpenConns(1)
+
+	// The page size is fixed once the journal mode is WAL
+	for _, pragma := range []string{
+		fmt.Sprintf("pragma page_size = %d", pageSize),
+		"pragma journal_mode = WAL",
+	} {
+		if _, err := db.Exec(pragma); err != nil {
+			return err
+		}
+	}
+	if _, err := db.Exec("attach database ? as src", src); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// The tables first, then their indexes
+	rows, err := tx.Query("select type, name, sql from src.sqlite_master " +
+		"where sql is not null and name not like 'sqlite_%' order by type = 'index'")
+	if err != nil {
+		return err
+	}
+	var stmts, tables []string
+	for rows.Next() {
+		var typ, name, stmt string
+		if err := rows.Scan(&typ, &name, &stmt); err != nil {
+			rows.Close()
+			return err
+		}
+		stmts = append(stmts, stmt)
+		if typ == "table" {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	for _, table := range tables {
+		query := fmt.Sprintf(`insert into main."%s" select * from src."%s"`, table, table)
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	var version int
+	if err := tx.QueryRow("pragma src.user_version").Scan(&version); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("pragma main.user_version = %d", version)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("detach database src"); err != nil {
+		return err
+	}
+	if err := integrityCheck(db); err != nil {
+		return err
+	}
+	var size int
+	if err := db.QueryRow("pragma page_size").Scan(&size); err != nil {
+		return err
+	}
+	if size != pageSize {
+		return fmt.Errorf("page size %d, not %d", size, pageSize)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package raftsqlite3
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_Rebuild(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithTermColumn())
+	defer os.Remove(path)
+
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64([]byte("term"), 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	version, err := store.SchemaVersion()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Rebuild(1000); err == nil {
+		t.Fatalf("should fail on an invalid page size")
+	}
+
+	if err := store.Rebuild(8192); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	pragmas, err := store.Pragmas()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if pragmas["page_size"] != "8192" || pragmas["journal_mode"] != "wal" {
+		t.Fatalf("bad: %v", pragmas)
+	}
+	// The store goes on with the same content
+	if err := store.StoreLog(testRaftLog(3, "log3")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	logs = append(logs, testRaftLog(3, "log3"))
+	store.Close()
+
+	store, err = raftsqlite3.New(path, raftsqlite3.WithTermColumn(), raftsqlite3.WithPageSize(8192))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	result, err := store.GetLogRange(1, 3)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, logs) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if byTerm, err := store.GetLogsByTerm(logs[0].Term); err != nil || len(byTerm) != 3 {
+		t.Fatalf("bad: %d, %v", len(byTerm), err)
+	}
+	if v, err := store.GetUint64([]byte("term")); err != nil || v != 2 {
+		t.Fatalf("bad: %d, %v", v, err)
+	}
+	if v, err := store.SchemaVersion(); err != nil || v != version {
+		t.Fatalf("bad: %d, %v", v, err)
+	}
+	if _, err := os.Stat(path + ".rebuild"); !os.IsNotExist(err) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestSqlite3Store_Rebuild_Failure(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A trigger failing the copy of the logs
+	trigger := "create trigger fail_insert before insert on logs begin select raise(fail, 'boom'); end"
+	if _, err := store.DB().Exec(trigger); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Rebuild(8192); err == nil {
+		t.Fatalf("should fail to copy the logs")
+	}
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if _, err := os.Stat(path + ".rebuild" + suffix); !os.IsNotExist(err) {
+			t.Fatalf("bad: %s left, %v", suffix, err)
+		}
+	}
+
+	// The store goes on with the original database
+	if _, err := store.DB().Exec("drop trigger fail_insert"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(3, "log3")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	result, err := store.GetLogRange(1, 3)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(result) != 3 {
+		t.Fatalf("bad: %#v", result)
+	}
+}
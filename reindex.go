@@ -0,0 +1,107 @@
+package raftsqlite3
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// ReindexLogs is like ReindexLogsN, without the number of logs corrected.
+func (s *Sqlite3Store) ReindexLogs() error {
+	_, err := s.ReindexLogsN()
+	return err
+}
+
+// ReindexLogsN moves each log whose id disagrees with the index it decodes
+// to, e.g. after a manual edit of the logs table, to the id of its index, in
+// one transaction, and returns the number of logs moved. It fails without
+// moving any if two logs decode to the same index.
+func (s *Sqlite3Store) ReindexLogsN() (n uint64, err error) {
+	if err = s.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer s.endWrite()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	ctx, cancel := s.opContext()
+	defer cancel()
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		err = timeoutError(ctx, err)
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := fmt.Sprintf("select id, %s from %s order by id asc", s.logColumns(), s.logTables())
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		ids     []uint64
+		moved   []*raft.Log
+		indexes = make(map[uint64]uint64)
+	)
+	for rows.Next() {
+		var (
+			id        uint64
+			val, data []byte
+		)
+		if err = rows.Scan(&id, &val, &data); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		log := new(raft.Log)
+		if err = s.decodeLog(val, data, log); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("%w at id %d: %v", ErrDecode, id, err)
+		}
+		if other, ok := indexes[log.Index]; ok {
+			rows.Close()
+			return 0, fmt.Errorf("logs at ids %d and %d both of index %d", other, id, log.Index)
+		}
+		indexes[log.Index] = id
+		if log.Index != id {
+			ids, moved = append(ids, id), append(moved, log)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(moved) == 0 {
+		return 0, tx.Rollback()
+	}
+
+	// Delete all the logs moved first, as they may swap ids
+	for _, id := range ids {
+		query = fmt.Sprintf("delete from %s where id = ?", dbLogs)
+		if _, err = tx.ExecContext(ctx, query, s.logKey(id)); err != nil {
+			return 0, err
+		}
+		if s.opts.splitData {
+			query = fmt.Sprintf("delete from %s where id = ?", dbLogData)
+			if _, err = tx.ExecContext(ctx, query, s.logKey(id)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	inserter, err := s.newLogInserter(ctx, tx, "insert")
+	if err != nil {
+		return 0, err
+	}
+	defer inserter.Close()
+	for _, log := range moved {
+		if _, err = inserter.insert(log); err != nil {
+			return 0, err
+		}
+	}
+
+	s.logger.Printf("[WARN ] %s: ReindexLogs() moved %d logs to the id of their index", tag, len(moved))
+	return uint64(len(moved)), tx.Commit()
+}
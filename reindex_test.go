@@ -0,0 +1,71 @@
+package raftsqlite3
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_ReindexLogs(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		var opts []raftsqlite3.Option
+		if split {
+			opts = append(opts, raftsqlite3.WithSplitData())
+		}
+		store, path := testSqlite3Store(t, opts...)
+		defer store.Close()
+		defer os.Remove(path)
+
+		logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2"), testRaftLog(3, "log3")}
+		if err := store.StoreLogs(logs); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if n, err := store.ReindexLogsN(); err != nil || n != 0 {
+			t.Fatalf("bad: %d, %v", n, err)
+		}
+
+		// Swap the ids of the logs 1 and 3, then move the log 2 away
+		tables := []string{"logs"}
+		if split {
+			tables = append(tables, "log_data")
+		}
+		for _, table := range tables {
+			for _, query := range []string{
+				"update %s set id = 0 where id = 1",
+				"update %s set id = 1 where id = 3",
+				"update %s set id = 3 where id = 0",
+				"update %s set id = 10 where id = 2",
+			} {
+				if _, err := store.DB().Exec(fmt.Sprintf(query, table)); err != nil {
+					t.Fatalf("err: %s", err)
+				}
+			}
+		}
+
+		if n, err := store.ReindexLogsN(); err != nil || n != 3 {
+			t.Fatalf("bad: %d, %v", n, err)
+		}
+		result, err := store.GetLogRange(1, 10)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(result, logs) {
+			t.Fatalf("bad: %#v", result)
+		}
+
+		// Logs of the same index are left
+		if _, err := store.DB().Exec("update logs set id = 5 where id = 2"); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := store.DB().Exec("insert into logs(id, value) select 2, value from logs where id = 5"); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := store.ReindexLogs(); err == nil {
+			t.Fatalf("should fail on logs of the same index")
+		}
+	}
+}
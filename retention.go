@@ -0,0 +1,104 @@
+package raftsqlite3
+
+import "fmt"
+
+// maxDiskBatch is the number of logs deleted at a time by WithMaxDiskBytes.
+const maxDiskBatch = 100
+
+// trimToMaxDiskBytes deletes the oldest logs while the pages in use exceed
+// the max disk bytes, keeping the last log, then releases the free pages if
+// the database is in incremental auto-vacuum mode.
+func (s *Sqlite3Store) trimToMaxDiskBytes() error {
+	limit := s.opts.maxDiskBytes
+	if limit <= 0 {
+		return nil
+	}
+
+	trimmed := false
+	for {
+		used, err := s.usedBytes()
+		if err != nil {
+			return err
+		}
+		if used <= limit {
+			break
+		}
+		first, err := s.FirstIndex()
+		if err != nil {
+			return err
+		}
+		last, err := s.LastIndex()
+		if err != nil {
+			return err
+		}
+		if first >= last {
+			// The last log alone exceeds the limit
+			break
+		}
+		max := first + maxDiskBatch - 1
+		if max >= last {
+			max = last - 1
+		}
+		if _, err := s.DeleteRangeN(first, max); err != nil {
+			return err
+		}
+		s.logger.Printf("[INFO ] %s: deleted logs [%d, %d] over the max disk bytes %d", tag, first, max, limit)
+		trimmed = true
+	}
+	if !trimmed {
+		return nil
+	}
+
+	var autoVacuum int
+	if err := s.db.QueryRow("pragma auto_vacuum").Scan(&autoVacuum); err != nil {
+		return err
+	}
+	if autoVacuum != 2 {
+		return nil
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	_, err := s.db.Exec("pragma incremental_vacuum")
+	return err
+}
+
+// usedBytes returns the bytes of the database pages in use, the free pages
+// left by the deleted logs excluded.
+func (s *Sqlite3Store) usedBytes() (int64, error) {
+	var pages, free, size int64
+	if err := s.db.QueryRow("pragma page_count").Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := s.db.QueryRow("pragma freelist_count").Scan(&free); err != nil {
+		return 0, err
+	}
+	if err := s.db.QueryRow("pragma page_size").Scan(&size); err != nil {
+		return 0, err
+	}
+	return (pages - free) * size, nil
+}
+
+// checkWALSizeLimit truncates the WAL with a checkpoint if its file reached
+// the WAL size limit, before a write adds to it. It returns ErrCheckpointBusy
+// if the WAL couldn't be truncated.
+func (s *Sqlite3Store) checkWALSizeLimit() error {
+	limit := s.opts.walSizeLimit
+	if limit <= 0 {
+		return nil
+	}
+	_, wal, _ := s.Files()
+	if wal == "" {
+		return nil
+	}
+	size, err := fileSize(wal)
+	if err != nil {
+		return err
+	}
+	if size < limit {
+		return nil
+	}
+	if err := s.TruncateWAL(); err != nil {
+		return fmt.Errorf("WAL of %d bytes at the limit of %d: %w", size, limit, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package raftsqlite3
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_MaxDiskBytes(t *testing.T) {
+	const limit = 64 << 10
+	store, path := testSqlite3Store(t, raftsqlite3.WithMaxDiskBytes(limit))
+	defer store.Close()
+	defer os.Remove(path)
+
+	data := string(bytes.Repeat([]byte("x"), 1024))
+	for i := uint64(1); i <= 1000; i += 10 {
+		var logs []*raft.Log
+		for j := i; j < i+10; j++ {
+			logs = append(logs, testRaftLog(j, data))
+		}
+		if err := store.StoreLogs(logs); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	var pages, free, size int64
+	db := store.DB()
+	if err := db.QueryRow("pragma page_count").Scan(&pages); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := db.QueryRow("pragma freelist_count").Scan(&free); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := db.QueryRow("pragma page_size").Scan(&size); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if used := (pages - free) * size; used > limit {
+		t.Fatalf("bad: %d", used)
+	}
+	first, err := store.FirstIndex()
+	if err != nil || first <= 1 {
+		t.Fatalf("bad: %d, %v", first, err)
+	}
+	if last, err := store.LastIndex(); err != nil || last != 1000 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+	if base, err := store.BaseIndex(); err != nil || base != first-1 {
+		t.Fatalf("bad: %d, %v", base, err)
+	}
+}
+
+func TestSqlite3Store_WALSizeLimit(t *testing.T) {
+	const limit = 64 << 10
+	store, path := testSqlite3Store(t, raftsqlite3.WithWALSizeLimit(limit),
+		raftsqlite3.WithWALAutoCheckpoint(0))
+	defer store.Close()
+	defer os.Remove(path)
+
+	data := bytes.Repeat([]byte("x"), 4096)
+	for i := uint64(1); i <= 100; i++ {
+		if err := store.StoreLog(&raft.Log{Index: i, Data: data}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		// Over the limit by a write at most
+		if fi, err := os.Stat(path + "-wal"); err != nil || fi.Size() > limit+32<<10 {
+			t.Fatalf("bad: %v, %v", fi, err)
+		}
+	}
+	if last, err := store.LastIndex(); err != nil || last != 100 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+}
@@ -0,0 +1,106 @@
+package raftsqlite3
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// The schema version is kept in pragma user_version, as the base version
+// combined with the flags of the optional schema features.
+const (
+	// schemaVersion is the version of the base schema.
+	schemaVersion = 1
+	// schemaConfIndex flags the covering index of the conf table.
+	schemaConfIndex = 1 << 8
+	// schemaTextKey flags the text id column of the logs.
+	schemaTextKey = 1 << 9
+)
+
+// SchemaVersion returns the schema version of the store, 0 if the store was
+// created before the version was recorded and never opened writable since.
+func (s *Sqlite3Store) SchemaVersion() (int, error) {
+	var version int
+	err := s.reader().QueryRow("pragma user_version").Scan(&version)
+	return version, err
+}
+
+// schemaFlags returns the flags of the schema features of the options.
+func (o *options) schemaFlags() int {
+	flags := 0
+	if o.confIndex {
+		flags |= schemaConfIndex
+	}
+	if o.logKeyType == "text" {
+		flags |= schemaTextKey
+	}
+	return flags
+}
+
+// initSchemaFeatures creates or drops the optional schema features, so that
+// the schema matches the options, then records the schema version.
+func (s *Sqlite3Store) initSchemaFeatures(tx *sql.Tx) error {
+	query := fmt.Sprintf("drop index if exists %s_id_value", dbConf)
+	if s.opts.confIndex {
+		query = fmt.Sprintf("create index if not exists %s_id_value on %s(id, value)", dbConf, dbConf)
+	}
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf("pragma user_version = %d", schemaVersion|s.opts.schemaFlags())
+	_, err := tx.Exec(query)
+	return err
+}
+
+// checkLogKeyType returns ErrSchemaMismatch if the logs table exists with
+// another key type than the options, as recorded in the schema version. The
+// stores created before the version was recorded have integer keys.
+func (s *Sqlite3Store) checkLogKeyType() error {
+	var version int
+	if err := s.db.QueryRow("pragma user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version == 0 {
+		var n int
+		query := fmt.Sprintf("select count(*) from sqlite_master where type = 'table' and name = '%s'", dbLogs)
+		if err := s.db.QueryRow(query).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			// A new store
+			return nil
+		}
+	}
+	typ := "integer"
+	if version&schemaTextKey != 0 {
+		typ = "text"
+	}
+	if typ != s.opts.logKeyType {
+		return fmt.Errorf("%w: the log key type is %s, open WithLogKeyType(%q)", ErrSchemaMismatch, typ, typ)
+	}
+	return nil
+}
+
+// checkPageSize returns ErrSchemaMismatch if the page size of the database
+// isn't the one of WithPageSize, which sqlite3 ignores for an existing one.
+func (s *Sqlite3Store) checkPageSize() error {
+	if s.opts.pageSize == 0 {
+		return nil
+	}
+	var size int
+	if err := s.db.QueryRow("pragma page_size").Scan(&size); err != nil {
+		return err
+	}
+	if size != s.opts.pageSize {
+		return fmt.Errorf("%w: the page size is %d, not %d", ErrSchemaMismatch, size, s.opts.pageSize)
+	}
+	return nil
+}
+
+// logKey returns the id of the log at idx, as bound in the queries.
+func (s *Sqlite3Store) logKey(idx uint64) interface{} {
+	if s.opts.logKeyType == "text" {
+		return fmt.Sprintf("%020d", idx)
+	}
+	return idx
+}
@@ -0,0 +1,85 @@
+package raftsqlite3
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// keyClean is the conf key of the clean shutdown flag, 0 while a writable
+// store is open and 1 once it's closed.
+var keyClean = []byte("raftsqlite3.clean")
+
+// WasCleanShutdown returns true if the store was closed gracefully before
+// it was opened, false if the previous run crashed or was killed before
+// Close. A store that didn't exist or predates the flag counts as clean. On
+// a read-only store it reports the current flag, which is false while a
+// writer has the store open.
+func (s *Sqlite3Store) WasCleanShutdown() (bool, error) {
+	if s.dirty {
+		return s.wasClean, nil
+	}
+	return getClean(s.reader())
+}
+
+func getClean(q queryRower) (bool, error) {
+	query := fmt.Sprintf("select value from %s where id = ?", dbConf)
+	var val []byte
+	err := q.QueryRow(query, keyClean).Scan(&val)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytesToUint64(val) != 0, nil
+}
+
+// markUnclean records the flag of the previous run, then clears it until
+// markClean, in a transaction bound to ctx.
+func (s *Sqlite3Store) markUnclean(ctx context.Context) (err error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	conn, release, err := s.openConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return classifyBeginError(err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	clean, err := getClean(tx)
+	if err != nil {
+		return err
+	}
+	query := s.setConfQuery()
+	if _, err = tx.ExecContext(ctx, query, keyClean, uint64ToBytes(0)); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	s.wasClean, s.dirty = clean, true
+	return nil
+}
+
+// markClean sets the flag cleared by markUnclean.
+func (s *Sqlite3Store) markClean() error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	query := s.setConfQuery()
+	if _, err := s.db.Exec(query, keyClean, uint64ToBytes(1)); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
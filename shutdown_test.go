@@ -0,0 +1,55 @@
+package raftsqlite3
+
+import (
+	"os"
+	"testing"
+
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_WasCleanShutdown(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+
+	// A new store counts as clean
+	clean, err := store.WasCleanShutdown()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !clean {
+		t.Fatalf("expected clean shutdown")
+	}
+
+	// Read-only stores see the flag of the open writer
+	ro, err := raftsqlite3.New(path + "?_query_only=true")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if clean, err := ro.WasCleanShutdown(); err != nil || clean {
+		t.Fatalf("bad: %t, %v", clean, err)
+	}
+	ro.Close()
+
+	// A graceful close
+	if err := store.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, err = raftsqlite3.New(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if clean, err := store.WasCleanShutdown(); err != nil || !clean {
+		t.Fatalf("bad: %t, %v", clean, err)
+	}
+
+	// Simulate a crash by closing the handle without closing the store
+	store.DB().Close()
+	store, err = raftsqlite3.New(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if clean, err := store.WasCleanShutdown(); err != nil || clean {
+		t.Fatalf("bad: %t, %v", clean, err)
+	}
+}
@@ -0,0 +1,69 @@
+package raftsqlite3
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// An error indicating the database is in use where it mustn't be
+var ErrInUse = errors.New("database in use")
+
+// CleanSidecars removes the -wal and -shm files left next to the database
+// file of a closed store, e.g. by a crash, once it checked that no connection
+// uses the database and that it's consistent: the WAL is checkpointed into the
+// database file before. It returns ErrInUse if the store isn't closed or if
+// another connection, e.g. of another process, has the database open, and
+// leaves the files in place if the database fails the check. It's meant for
+// recovery scripts, and races with a process opening the database meanwhile.
+func (s *Sqlite3Store) CleanSidecars() error {
+	select {
+	case <-s.closeCh:
+	default:
+		return fmt.Errorf("%w: close the store first", ErrInUse)
+	}
+	main, wal, shm := s.Files()
+	if main == "" {
+		return nil
+	}
+
+	// The exclusive locking mode fails on a database open elsewhere, and
+	// doesn't use the -shm file
+	dsn := setDSNParam(s.dsn, "_locking_mode", "EXCLUSIVE")
+	dsn = setDSNParam(dsn, "_busy_timeout", "0", "_timeout")
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var result string
+	err = db.QueryRow("pragma quick_check").Scan(&result)
+	if e, ok := err.(sqlite3.Error); ok && (e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked) {
+		return fmt.Errorf("%w: %s", ErrInUse, err)
+	}
+	if err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("quick check: %s", result)
+	}
+	if _, err := db.Exec("pragma wal_checkpoint(TRUNCATE)"); err != nil {
+		return err
+	}
+	// Closing the last connection removes the WAL
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	for _, path := range []string{wal, shm} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
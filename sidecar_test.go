@@ -0,0 +1,64 @@
+package raftsqlite3
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_CleanSidecars(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.CleanSidecars(); !errors.Is(err, raftsqlite3.ErrInUse) {
+		t.Fatalf("expected in use error, got: %v", err)
+	}
+
+	// Another process has the database open
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("select count(*) from logs").Scan(&n); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+	if err := store.CleanSidecars(); !errors.Is(err, raftsqlite3.ErrInUse) {
+		t.Fatalf("expected in use error, got: %v", err)
+	}
+	db.Close()
+
+	// Stale files left by a crash
+	if err := ioutil.WriteFile(path+"-wal", nil, 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ioutil.WriteFile(path+"-shm", make([]byte, 32768), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.CleanSidecars(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(path + suffix); !os.IsNotExist(err) {
+			t.Fatalf("expected %s removed, got: %v", suffix, err)
+		}
+	}
+
+	reopened, err := raftsqlite3.New(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer reopened.Close()
+	if last, err := reopened.LastIndex(); err != nil || last != 2 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+}
@@ -1,13 +1,20 @@
 package raftsqlite3
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"database/sql"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"math"
-	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	
 	"github.com/mattn/go-sqlite3"
@@ -19,58 +26,244 @@ const (
 	// Table names we perform transactions in
 	dbLogs = "logs"
 	dbConf = "conf"
+	// dbLogData holds the log data apart with WithSplitData
+	dbLogData = "log_data"
 )
 
 var (
 	// An error indicating a given key does not exist
 	ErrKeyNotFound = errors.New("not found")
+
+	// An error indicating the store is draining and rejects new writes
+	ErrDraining = errors.New("store is draining")
+
+	// An error indicating the operation needs an option the store wasn't opened with
+	ErrNotSupported = errors.New("not supported by the store options")
+
+	// An error indicating a value exceeds the configured max value size
+	ErrValueTooLarge = errors.New("value too large")
+
+	// An error indicating a stored log is present but can't be decoded
+	ErrDecode = errors.New("log decode failed")
+
+	// An error indicating a checkpoint couldn't complete for other connections
+	ErrCheckpointBusy = errors.New("checkpoint busy")
+
+	// An error indicating a stored log has a null or empty value
+	ErrEmptyLogValue = errors.New("empty log value")
+
+	// An error indicating the store holds logs where it must be empty
+	ErrNotEmpty = errors.New("store not empty")
+
+	// An error indicating the logs are written in an unknown codec version
+	ErrCodecVersion = errors.New("unknown codec version")
+
+	// An error indicating a log to store can't be encoded
+	ErrEncode = errors.New("log encode failed")
+
+	// An error indicating the VFS of WithVFS isn't registered
+	ErrVFSNotRegistered = errors.New("vfs not registered")
+
+	// An error indicating a log index is at or below the base index
+	ErrBelowBase = errors.New("index at or below the base index")
+
+	// An error indicating the store was created with different schema options
+	ErrSchemaMismatch = errors.New("store schema mismatches the options")
+
+	// An error indicating a statement ran longer than the statement timeout
+	ErrStatementTimeout = errors.New("statement timed out")
+
+	// An error indicating a transaction panicked and was rolled back
+	ErrPanic = errors.New("transaction panicked")
+
+	// An error indicating the store couldn't be initialized in time
+	ErrOpenTimeout = errors.New("open timed out")
+
+	// An error indicating a write failed on the mirror store
+	ErrMirror = errors.New("mirror write failed")
+
+	// An error indicating the store doesn't grow, so never gets full
+	ErrNeverFull = errors.New("store not growing")
+
+	// An error indicating a log at index 0, which Raft never uses
+	ErrZeroIndex = errors.New("log at index 0")
 )
 
 // Sqlite3Store provides access to sqlite3 for Raft to store and retrieve
 // log entries. It also provides key/value storage, and can be used as
 // a LogStore and StableStore.
 type Sqlite3Store struct {
+	// busyRetries counts the busy retries, first for the 64-bit alignment
+	// of the atomic operations.
+	busyRetries uint64
+	// lastCheckpoint is the time of the last successful checkpoint, or of
+	// the open before any, in nanoseconds since the Unix epoch.
+	lastCheckpoint int64
+	// storedSinceCheckpoint counts the logs stored since the last successful
+	// checkpoint, for WithCheckpointEveryN.
+	storedSinceCheckpoint uint64
+	// readsInFlight counts the reads running.
+	readsInFlight int64
+
 	// db is the underlying handle to the db.
 	db *sql.DB
+	// rdb is the handle for reads when they have their own busy timeout.
+	rdb *sql.DB
+	// dsn is the effective data source name the store was opened with.
+	dsn string
 	logger *log.Logger
+	opts *options
+
+	// mu guards draining.
+	mu sync.Mutex
+	draining bool
+	// writes tracks the in-flight write operations.
+	writes sync.WaitGroup
+	// wmu serializes the writers and checkpoints of the store.
+	wmu sync.Mutex
+
+	// closeCh is closed when the store is closed, to stop the background
+	// goroutines tracked by bg.
+	closeCh chan struct{}
+	closeOnce sync.Once
+	bg sync.WaitGroup
+
+	// dirty is true while the clean shutdown flag is cleared by this store,
+	// and wasClean is the flag found on open.
+	dirty bool
+	wasClean bool
+	// created is true if the tables were created by the open.
+	created bool
+
+	// written is notified after the writes, with WithDeferredCheckpoint.
+	written chan struct{}
+	// readSem bounds the concurrent reads, with WithMaxConcurrentReads.
+	readSem chan struct{}
+	// writeLimiter throttles the logs stored, with WithWriteRateLimit.
+	writeLimiter *rateLimiter
+
+	// amu guards attached, the aliases of the attached databases, and
+	// maxOpenConns, the pool limit before the first of them.
+	amu sync.Mutex
+	attached map[string]bool
+	maxOpenConns int
 }
 
-func NewSqlite3Store(dataSourceName string) (*Sqlite3Store, error) {
-	return New(dataSourceName)
+func NewSqlite3Store(dataSourceName string, opts ...Option) (*Sqlite3Store, error) {
+	return New(dataSourceName, opts...)
 }
 
 // New uses the supplied dataSourceName to open the sqlite3 and prepare it for use as a raft backend.
-func New(dataSourceName string) (*Sqlite3Store, error) {
-	logger := log.New(os.Stderr, "", log.LstdFlags)
+func New(dataSourceName string, opts ...Option) (*Sqlite3Store, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	logger := o.logger
 	if strings.Index(dataSourceName, "?") == -1 {
 		const extra = "_busy_timeout=30000&_journal_mode=WAL"//"&_synchronous=NORMAL"
 		dataSourceName = fmt.Sprintf("%s?%s", dataSourceName, extra)
 	}
+	if o.vfs != "" {
+		dataSourceName = setDSNParam(dataSourceName, "vfs", o.vfs)
+	}
+	if o.sharedCache {
+		dataSourceName = setDSNParam(fileURI(dataSourceName), "cache", "shared")
+	}
+	if o.immutable {
+		dataSourceName = setDSNParam(fileURI(dataSourceName), "immutable", "1")
+		dataSourceName = setDSNParam(dataSourceName, "_query_only", "true")
+	}
+	if o.pageSize > 0 {
+		// Set the journal mode after the page size
+		dataSourceName, o.journalMode = takeDSNParam(dataSourceName, "_journal_mode", "_journal")
+	}
+	if o.writeTimeout > 0 {
+		timeout := strconv.FormatInt(o.writeTimeout.Milliseconds(), 10)
+		dataSourceName = setDSNParam(dataSourceName, "_busy_timeout", timeout, "_timeout")
+	}
 	// Try to open and connect
 	logger.Printf("[INFO ] %s: Open %s", tag, dataSourceName)
-	db, err := sql.Open("sqlite3", dataSourceName)
-	if err != nil {
-		return nil, err
-	}
+	db := sql.OpenDB(newConnector(dataSourceName, o))
 
 	// Create the new store
 	store := &Sqlite3Store{
 		db: db,
+		dsn: dataSourceName,
 		logger: logger,
+		opts: o,
+		closeCh: make(chan struct{}),
+		lastCheckpoint: time.Now().UnixNano(),
+	}
+	if o.maxConcurrentReads > 0 {
+		store.readSem = make(chan struct{}, o.maxConcurrentReads)
+	}
+	if o.writeRateLimit > 0 {
+		store.writeLimiter = newRateLimiter(o.writeRateLimit)
+	}
+	if o.readBusyTimeout > 0 && o.image == nil {
+		store.rdb = sql.OpenDB(newReadConnector(dataSourceName, o))
+	}
+	if o.image != nil {
+		if err := store.deserialize(o.image); err != nil {
+			store.Close()
+			return nil, err
+		}
 	}
 
 	// If the store was opened read-only, don't try and create tables
 	readOnly, err := store.readOnly()
 	if err != nil {
+		store.Close()
+		if o.vfs != "" && strings.Contains(err.Error(), "no such vfs") {
+			return nil, fmt.Errorf("%w: %s", ErrVFSNotRegistered, o.vfs)
+		}
+		return nil, err
+	}
+	if err := store.checkSplitData(); err != nil {
+		store.Close()
+		return nil, err
+	}
+	if err := store.checkLogKeyType(); err != nil {
 		store.Close()
 		return nil, err
 	}
+	// The writes of the opening are bounded by the open timeout together
+	ctx, cancel := store.openContext()
+	defer cancel()
 	if !readOnly {
 		// Set up our buckets
-		if err := store.initialize(); err != nil {
+		if err := store.openRetrying(ctx, "initialize()", store.initialize); err != nil {
+			store.Close()
+			return nil, err
+		}
+		if err := store.openRetrying(ctx, "markUnclean()", store.markUnclean); err != nil {
 			store.Close()
 			return nil, err
 		}
+		if o.autoCheckpointInterval > 0 {
+			store.bg.Add(1)
+			go store.autoCheckpoint(o.autoCheckpointInterval, o.autoCheckpointMode)
+		}
+		if o.deferredCheckpoint {
+			store.written = make(chan struct{}, 1)
+			store.bg.Add(1)
+			go store.deferredCheckpoint(deferredCheckpointIdle)
+		}
+	}
+	initMsgpackVersion := func(ctx context.Context) error {
+		return store.initMsgpackVersion(ctx, readOnly)
+	}
+	if err := store.openRetrying(ctx, "initMsgpackVersion()", initMsgpackVersion); err != nil {
+		store.Close()
+		return nil, err
+	}
+	if err := store.checkPageSize(); err != nil {
+		store.Close()
+		return nil, err
 	}
 	
 	return store, nil
@@ -85,12 +278,82 @@ func (s *Sqlite3Store) readOnly() (bool, error) {
 	return readOnly, err
 }
 
-// initialize is used to set up all of the tables.
-func (s *Sqlite3Store) initialize() error {
-	tx, err := s.db.Begin()
+// openContext returns the context bounding the writes made by New, which
+// expires after the open timeout if any.
+func (s *Sqlite3Store) openContext() (context.Context, context.CancelFunc) {
+	if d := s.opts.openTimeout; d > 0 {
+		return context.WithTimeout(context.Background(), d)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// openRetrying runs op, retried while the database is busy, e.g. when several
+// processes open it together, until ctx expires. It returns ErrOpenTimeout
+// once expired.
+func (s *Sqlite3Store) openRetrying(ctx context.Context, method string, op func(context.Context) error) error {
+	start := time.Now()
+	for retries := 0; ; retries++ {
+		err := op(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w after %s: %v", ErrOpenTimeout, time.Since(start), err)
+		}
+		if !s.waitIfBusy(method, err, 50 * time.Millisecond, start, retries) {
+			return err
+		}
+	}
+}
+
+// openConn returns a connection bound to ctx, and the function releasing it.
+// The busy timeout of the connection is capped by the deadline of ctx until
+// released, as the busy handler of sqlite waits regardless of the context.
+func (s *Sqlite3Store) openConn(ctx context.Context) (*sql.Conn, func(), error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, nil, classifyBeginError(err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return conn, func() { conn.Close() }, nil
+	}
+
+	var busyTimeout int64
+	if err := conn.QueryRowContext(ctx, "pragma busy_timeout").Scan(&busyTimeout); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	left := time.Until(deadline).Milliseconds()
+	if left >= busyTimeout {
+		return conn, func() { conn.Close() }, nil
+	}
+	query := fmt.Sprintf("pragma busy_timeout = %d", left)
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	release := func() {
+		query := fmt.Sprintf("pragma busy_timeout = %d", busyTimeout)
+		conn.ExecContext(context.Background(), query)
+		conn.Close()
+	}
+	return conn, release, nil
+}
+
+// initialize is used to set up all of the tables, in a transaction bound to
+// ctx.
+func (s *Sqlite3Store) initialize(ctx context.Context) (err error) {
+	conn, release, err := s.openConn(ctx)
 	if err != nil {
 		return err
 	}
+	defer release()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return classifyBeginError(err)
+	}
 	defer func(){
 		if err != nil {
 			tx.Rollback()
@@ -98,12 +361,19 @@ func (s *Sqlite3Store) initialize() error {
 		}
 		if m := recover(); m != nil{
 			tx.Rollback()
-			err = fmt.Errorf("%s", m)
+			err = s.panicError(m)
 		}
 	}()
 
+	var existing int
+	query := fmt.Sprintf("select count(*) from sqlite_master where type = 'table' and name = '%s'", dbLogs)
+	if err := tx.QueryRowContext(ctx, query).Scan(&existing); err != nil {
+		return err
+	}
+
 	// Create all the tables
-	query := fmt.Sprintf("create table if not exists %s(id integer not null primary key, value blob)", dbLogs)
+	keyType := s.opts.logKeyType
+	query = fmt.Sprintf("create table if not exists %s(id %s not null primary key, value blob)", dbLogs, keyType)
 	if _, err := tx.Exec(query); err != nil {
 		return err
 	}
@@ -111,213 +381,1749 @@ func (s *Sqlite3Store) initialize() error {
 	if _, err := tx.Exec(query); err != nil {
 		return err
 	}
+	if s.opts.splitData {
+		query = fmt.Sprintf("create table if not exists %s(id %s not null primary key, data blob)", dbLogData, keyType)
+		if _, err = tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	if s.opts.termColumn {
+		if err = s.initTermColumn(tx); err != nil {
+			return err
+		}
+	}
+	if s.opts.typeColumn {
+		if err = s.initTypeColumn(tx); err != nil {
+			return err
+		}
+	}
+	if s.opts.partition != nil {
+		if err = s.initPartitionColumn(tx); err != nil {
+			return err
+		}
+	}
+	if s.opts.timestamps {
+		if err = initStoredAtColumn(tx); err != nil {
+			return err
+		}
+	}
+	if s.opts.confOrdering {
+		if err = initConfSeqColumn(tx); err != nil {
+			return err
+		}
+	}
+	if err = s.initSchemaFeatures(tx); err != nil {
+		return err
+	}
 
-	return tx.Commit()
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	s.created = existing == 0
+	return nil
 }
 
-// Close is used to gracefully close the DB connection.
-func (s *Sqlite3Store) Close() error {
-	if s.db == nil {
+// checkSplitData returns ErrSchemaMismatch if the log data is held apart but
+// the store isn't opened WithSplitData, which would lose the data on reads.
+func (s *Sqlite3Store) checkSplitData() error {
+	if s.opts.splitData {
 		return nil
 	}
-	return s.db.Close()
-}
-
-// FirstIndex returns the first known index from the Raft log.
-func (s *Sqlite3Store) FirstIndex() (uint64, error) {
-	query  := fmt.Sprintf("select id from %s order by id asc limit 1", dbLogs)
-	stmt, err := s.db.Prepare(query)
-	if err != nil {
-		return 0, err
+	var n int
+	query := fmt.Sprintf("select count(*) from sqlite_master where type = 'table' and name = '%s'", dbLogData)
+	if err := s.db.QueryRow(query).Scan(&n); err != nil {
+		return err
 	}
-	defer stmt.Close()
-	
-	var first uint64
-	row := stmt.QueryRow()
-	err = row.Scan(&first)
-	if err == sql.ErrNoRows {
-		return 0, nil
+	if n > 0 {
+		return fmt.Errorf("%w: the log data is split, open WithSplitData", ErrSchemaMismatch)
 	}
-	
-	return first, err
+	return nil
 }
 
-// LastIndex returns the last known index from the Raft log.
-func (s *Sqlite3Store) LastIndex() (uint64, error) {
-	query  := fmt.Sprintf("select id from %s order by id desc limit 1", dbLogs)
-	stmt, err := s.db.Prepare(query)
+// initTermColumn adds the indexed term column to the logs table, and fills
+// it in for the logs stored before the column existed.
+func (s *Sqlite3Store) initTermColumn(tx *sql.Tx) error {
+	added, err := addColumnIfNotExists(tx, dbLogs, "term", "integer")
 	if err != nil {
-		return 0, err
+		return err
 	}
-	defer stmt.Close()
-	
-	var last uint64
-	row := stmt.QueryRow()
-	err = row.Scan(&last)
-	if err == sql.ErrNoRows {
-		return 0, nil
+	query := fmt.Sprintf("create index if not exists %s_term on %s(term)", dbLogs, dbLogs)
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if !added {
+		return nil
 	}
-	
-	return last, err
-}
 
-// GetLog is used to retrieve a log from sqlite3 at a given index.
-func (s *Sqlite3Store) GetLog(idx uint64, log *raft.Log) error {
-	query  := fmt.Sprintf("select value from %s where id = ?", dbLogs)
-	stmt, err := s.db.Prepare(query)
+	rows, err := tx.Query(s.logsQuery(""))
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-	
-	var val []byte
-	row := stmt.QueryRow(idx)
-	err = row.Scan(&val)
-	if err == sql.ErrNoRows {
-		return raft.ErrLogNotFound
+	logs, err := s.scanLogs(rows)
+	if err != nil {
+		return err
 	}
-	
-	return decodeMsgPack(val, log)
-}
-
-// StoreLog is used to store a single raft log
-func (s *Sqlite3Store) StoreLog(log *raft.Log) error {
-	return s.StoreLogs([]*raft.Log{log})
-}
-
-// StoreLogs is used to store a set of raft logs
-func (s *Sqlite3Store) StoreLogs(logs []*raft.Log) (err error) {
-	// Try to do when busy
-	// @since 2019-06-11 little-pan
-	for {
-		if err = s.doStoreLogs(logs); err != nil {
-			if s.waitIfBusy("StoreLogs()", err, 100 * time.Millisecond) {
-				continue
-			}
+	query = fmt.Sprintf("update %s set term = ? where id = ?", dbLogs)
+	for _, log := range logs {
+		if _, err := tx.Exec(query, log.Term, s.logKey(log.Index)); err != nil {
 			return err
 		}
-		
-		return nil
 	}
+
+	return nil
 }
 
-func (s *Sqlite3Store) doStoreLogs(logs []*raft.Log) (err error) {
-	tx, err := s.db.Begin()
+// initTypeColumn adds the indexed type column to the logs table, and fills it
+// in for the logs stored before the column existed.
+func (s *Sqlite3Store) initTypeColumn(tx *sql.Tx) error {
+	added, err := addColumnIfNotExists(tx, dbLogs, "type", "integer")
 	if err != nil {
-		return
+		return err
+	}
+	query := fmt.Sprintf("create index if not exists %s_type on %s(type, id)", dbLogs, dbLogs)
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if !added {
+		return nil
 	}
-	defer func(){
-		if err != nil {
-			tx.Rollback()
-			return
-		}
-		if m := recover(); m != nil{
-			tx.Rollback()
-			err = fmt.Errorf("%s", m)
-		}
-	}()
 
-	query := fmt.Sprintf("insert into %s(id, value)values(?, ?)", dbLogs)
-	stmt, err := tx.Prepare(query)
+	rows, err := tx.Query(s.logsQuery(""))
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-	
+	logs, err := s.scanLogs(rows)
+	if err != nil {
+		return err
+	}
+	query = fmt.Sprintf("update %s set type = ? where id = ?", dbLogs)
 	for _, log := range logs {
-		key := log.Index
-		val, err := encodeMsgPack(log)
-		if err != nil {
-			return err
-		}
-		if _, err = stmt.Exec(key, val.Bytes()) ; err != nil {
+		if _, err := tx.Exec(query, int(log.Type), s.logKey(log.Index)); err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	return nil
 }
 
-// DeleteRange is used to delete logs within a given range inclusively.
-func (s *Sqlite3Store) DeleteRange(min, max uint64) error {
-	// Delete range by batch for database locked issue
-	// @since 2019-06-11 little-pan
-	a, batch := min, uint64(999)
-	b := uint64(math.Min(float64(a + batch), float64(max - a + uint64(1))))
-	for {
-		if err := s.doDeleteRange(a, b); err != nil {
-			if s.waitIfBusy("DeleteRange()", err, 250 * time.Millisecond) {
-				continue
-			}
+// initPartitionColumn adds the indexed partition_id column to the logs table, and
+// fills it in for the logs stored before the column existed.
+func (s *Sqlite3Store) initPartitionColumn(tx *sql.Tx) error {
+	added, err := addColumnIfNotExists(tx, dbLogs, "partition_id", "integer")
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("create index if not exists %s_partition_id on %s(partition_id, id)", dbLogs, dbLogs)
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if !added {
+		return nil
+	}
+
+	rows, err := tx.Query(s.logsQuery(""))
+	if err != nil {
+		return err
+	}
+	logs, err := s.scanLogs(rows)
+	if err != nil {
+		return err
+	}
+	query = fmt.Sprintf("update %s set partition_id = ? where id = ?", dbLogs)
+	for _, log := range logs {
+		if _, err := tx.Exec(query, s.opts.partition(log), s.logKey(log.Index)); err != nil {
 			return err
 		}
-		
-		a = b + uint64(1)
-		if a > max {
-			return nil
-		}
-		
-		b += uint64(math.Min(float64(a + batch), float64(max - a + uint64(1))))
 	}
-}
 
-func (s *Sqlite3Store) waitIfBusy(method string, err error, sleep time.Duration) bool {
-	e := err.(sqlite3.Error)
-	if e.Code == sqlite3.ErrLocked || e.Code == sqlite3.ErrBusy {
-		// Try to do again when busy
-		log.Printf("[WARN ] %s: %s %s, sleep %s then retry", tag, method, err, sleep)
-		time.Sleep(sleep)
-		return true
-	}
-	
-	return false
+	return nil
 }
 
-func (s *Sqlite3Store) doDeleteRange(min, max uint64) error {
-	query := fmt.Sprintf("delete from %s where id >= ? and id <= ?", dbLogs)
-	stmt, err := s.db.Prepare(query)
-	if err != nil {
+// initStoredAtColumn adds the indexed stored_at column to the logs table. The
+// logs stored before the column existed have no time.
+func initStoredAtColumn(tx *sql.Tx) error {
+	if _, err := addColumnIfNotExists(tx, dbLogs, "stored_at", "integer"); err != nil {
 		return err
 	}
-	defer stmt.Close()
-	
-	_, err = stmt.Exec(min, max)
+	query := fmt.Sprintf("create index if not exists %s_stored_at on %s(stored_at)", dbLogs, dbLogs)
+	_, err := tx.Exec(query)
 	return err
 }
 
-// Set is used to set a key/value set outside of the raft log
-func (s *Sqlite3Store) Set(k, v []byte) error {
-	query := fmt.Sprintf("replace into %s(id, value)values(?, ?)", dbConf)
-	stmt, err := s.db.Prepare(query)
+// addColumnIfNotExists adds the column to the table unless it's already there,
+// and reports whether it was added.
+func addColumnIfNotExists(tx *sql.Tx, table, column, decl string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("pragma table_info(%s)", table))
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer stmt.Close()
-	
-	if _, err := stmt.Exec(k, v); err != nil {
-		return err
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ string
+			dflt sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return false, nil
+		}
 	}
-	
-	return nil
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	rows.Close()
+
+	query := fmt.Sprintf("alter table %s add column %s %s", table, column, decl)
+	if _, err := tx.Exec(query); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-// Get is used to retrieve a value from the k/v store by key
+// DataSourceName returns the effective data source name the store was opened
+// with, after the defaults were merged. It's returned as is, so it contains any
+// secret that was embedded in the data source name.
+func (s *Sqlite3Store) DataSourceName() string {
+	return s.dsn
+}
+
+// Files returns the paths of the database file and of its -wal and -shm
+// files, derived from the data source name. They're all empty for an
+// in-memory database. The -wal and -shm files only exist in WAL mode.
+func (s *Sqlite3Store) Files() (main, wal, shm string) {
+	main = dsnPath(s.dsn)
+	if main == "" {
+		return "", "", ""
+	}
+	return main, main + "-wal", main + "-shm"
+}
+
+// DB returns the underlying database handle.
+func (s *Sqlite3Store) DB() *sql.DB {
+	return s.db
+}
+
+// reader returns the handle for reads.
+func (s *Sqlite3Store) reader() *sql.DB {
+	if s.rdb != nil {
+		return s.rdb
+	}
+	return s.db
+}
+
+// Close is used to gracefully close the DB connection.
+func (s *Sqlite3Store) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+	})
+	s.bg.Wait()
+	if s.dirty {
+		if err := s.markClean(); err != nil {
+			s.logger.Printf("[WARN ] %s: mark clean shutdown %s", tag, err)
+		}
+	}
+	if s.rdb != nil {
+		s.rdb.Close()
+	}
+	return s.db.Close()
+}
+
+// Drain blocks new writes and waits for the in-flight ones to finish,
+// after which Close is safe. It returns ctx.Err() if ctx is done first.
+func (s *Sqlite3Store) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.writes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// beginWrite registers an in-flight write, or returns ErrDraining once
+// Drain has been called. Each successful call must be paired with endWrite.
+func (s *Sqlite3Store) beginWrite() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return ErrDraining
+	}
+	s.writes.Add(1)
+	return nil
+}
+
+// beginRead waits for a slot of the concurrent reads if they're bounded, then
+// counts the read in flight until endRead.
+func (s *Sqlite3Store) beginRead() {
+	if s.readSem != nil {
+		s.readSem <- struct{}{}
+	}
+	atomic.AddInt64(&s.readsInFlight, 1)
+}
+
+// endRead marks an in-flight read as finished.
+func (s *Sqlite3Store) endRead() {
+	atomic.AddInt64(&s.readsInFlight, -1)
+	if s.readSem != nil {
+		<-s.readSem
+	}
+}
+
+// endWrite marks an in-flight write as finished.
+func (s *Sqlite3Store) endWrite() {
+	s.writes.Done()
+	if s.written != nil {
+		select {
+		case s.written <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// isLockedTimeout is how long IsLocked waits for the write lock.
+const isLockedTimeout = 10 * time.Millisecond
+
+// IsLocked returns true if another connection, e.g. of another process,
+// holds the write lock of the database. It begins an immediate transaction on
+// a new connection, waiting shortly for the lock, and rolls it back at once.
+// The writes of the store itself wait meanwhile. It's a best-effort check, the
+// lock may be taken right after.
+func (s *Sqlite3Store) IsLocked() (bool, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	timeout := strconv.FormatInt(isLockedTimeout.Milliseconds(), 10)
+	dsn := setDSNParam(s.dsn, "_busy_timeout", timeout, "_timeout")
+	dsn = setDSNParam(dsn, "_txlock", "immediate")
+	db := sql.OpenDB(newPragmaConnector(dsn, s.opts.pragmas()))
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if e, ok := err.(sqlite3.Error); ok && (e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Rollback()
+}
+
+// FirstIndex returns the first known index from the Raft log. A log stored at
+// index 0 is skipped, as 0 stands for an empty log, see WithRejectIndexZero.
+func (s *Sqlite3Store) FirstIndex() (uint64, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	ctx, cancel := s.opContext()
+	defer cancel()
+	return s.firstIndex(ctx)
+}
+
+// firstIndex is FirstIndex bound to ctx, within the read slot of the caller.
+func (s *Sqlite3Store) firstIndex(ctx context.Context) (uint64, error) {
+	query  := fmt.Sprintf("select id from %s where id >= ? order by id asc limit 1", dbLogs)
+	stmt, err := s.reader().PrepareContext(ctx, query)
+	if err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	defer stmt.Close()
+	
+	var first uint64
+	row := stmt.QueryRowContext(ctx, s.logKey(1))
+	err = row.Scan(&first)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	
+	return first, timeoutError(ctx, err)
+}
+
+// LastIndex returns the last known index from the Raft log.
+func (s *Sqlite3Store) LastIndex() (uint64, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	query  := fmt.Sprintf("select id from %s order by id desc limit 1", dbLogs)
+	ctx, cancel := s.opContext()
+	defer cancel()
+	stmt, err := s.reader().PrepareContext(ctx, query)
+	if err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	defer stmt.Close()
+	
+	var last uint64
+	row := stmt.QueryRowContext(ctx)
+	err = row.Scan(&last)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	
+	return last, timeoutError(ctx, err)
+}
+
+// GetLogMeta returns the index, term and type of the log at idx. With
+// WithTermColumn and WithTypeColumn they're read from their columns without
+// decoding the log, else the log is fully decoded like GetLog and only its
+// meta data is returned.
+func (s *Sqlite3Store) GetLogMeta(idx uint64) (index, term uint64, typ raft.LogType, err error) {
+	if !s.opts.termColumn || !s.opts.typeColumn {
+		log := new(raft.Log)
+		if err := s.GetLog(idx, log); err != nil {
+			return 0, 0, 0, err
+		}
+		return log.Index, log.Term, log.Type, nil
+	}
+
+	s.beginRead()
+	defer s.endRead()
+	query := fmt.Sprintf("select term, type from %s where id = ?", dbLogs)
+	ctx, cancel := s.opContext()
+	defer cancel()
+	var t int
+	err = s.reader().QueryRowContext(ctx, query, s.logKey(idx)).Scan(&term, &t)
+	if err == sql.ErrNoRows {
+		if fb := s.opts.readFallback; fb != nil {
+			log := new(raft.Log)
+			if err := fb.GetLog(idx, log); err != nil {
+				return 0, 0, 0, err
+			}
+			return log.Index, log.Term, log.Type, nil
+		}
+		return 0, 0, 0, raft.ErrLogNotFound
+	}
+	if err != nil {
+		return 0, 0, 0, timeoutError(ctx, err)
+	}
+	return idx, term, raft.LogType(t), nil
+}
+
+// NextIndex returns the index of the next log to append, LastIndex()+1, so 1
+// when the store is empty.
+func (s *Sqlite3Store) NextIndex() (uint64, error) {
+	last, err := s.LastIndex()
+	if err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
+
+// GetLog is used to retrieve a log from sqlite3 at a given index.
+func (s *Sqlite3Store) GetLog(idx uint64, log *raft.Log) error {
+	s.beginRead()
+	defer s.endRead()
+
+	query  := s.logsQuery("where id = ?")
+	ctx, cancel := s.opContext()
+	defer cancel()
+	stmt, err := s.reader().PrepareContext(ctx, query)
+	if err != nil {
+		return timeoutError(ctx, err)
+	}
+	defer stmt.Close()
+	
+	var val, data []byte
+	row := stmt.QueryRowContext(ctx, s.logKey(idx))
+	err = row.Scan(&val, &data)
+	if err == sql.ErrNoRows {
+		if fb := s.opts.readFallback; fb != nil {
+			return fb.GetLog(idx, log)
+		}
+		return raft.ErrLogNotFound
+	}
+	if err != nil {
+		return timeoutError(ctx, err)
+	}
+	if len(val) == 0 {
+		return fmt.Errorf("%w at index %d", ErrEmptyLogValue, idx)
+	}
+	
+	if err := s.decodeLog(val, data, log); err != nil {
+		return fmt.Errorf("%w at index %d: %v", ErrDecode, idx, err)
+	}
+	return nil
+}
+
+// GetLogRange returns the logs within the given range inclusively in index
+// order. With WithReadFallback, the logs of the range below the first index
+// of the store are read from the fallback store, within its first and last
+// indexes, and the ones missing from both are skipped.
+func (s *Sqlite3Store) GetLogRange(min, max uint64) ([]*raft.Log, error) {
+	s.beginRead()
+	defer s.endRead()
+	start := time.Now()
+	defer s.logIfSlow("GetLogRange()", start, "range=[%d, %d]", min, max)
+
+	query := s.logsQuery("where id >= ? and id <= ? order by id asc")
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query, s.logKey(min), s.logKey(max))
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	logs, err := s.scanLogs(rows)
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	fb := s.opts.readFallback
+	if fb == nil || min > max || uint64(len(logs)) == max-min+1 {
+		return logs, nil
+	}
+
+	// Fill the head of the range from the fallback store, with the logs below
+	// the first index of this store
+	lo, err := fb.FirstIndex()
+	if err != nil {
+		return nil, err
+	}
+	hi, err := fb.LastIndex()
+	if err != nil {
+		return nil, err
+	}
+	first, err := s.firstIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if first != 0 && first-1 < hi {
+		hi = first - 1
+	}
+	if lo < min {
+		lo = min
+	}
+	if hi > max {
+		hi = max
+	}
+	if lo == 0 || lo > hi {
+		return logs, nil
+	}
+	filled := make([]*raft.Log, 0, len(logs))
+	for idx := lo; ; idx++ {
+		if err := ctx.Err(); err != nil {
+			return nil, timeoutError(ctx, err)
+		}
+		log := new(raft.Log)
+		err := fb.GetLog(idx, log)
+		if err != nil && err != raft.ErrLogNotFound {
+			return nil, err
+		}
+		if err == nil {
+			filled = append(filled, log)
+		}
+		if idx == hi {
+			return append(filled, logs...), nil
+		}
+	}
+}
+
+// GetLogRangeLimited is like GetLogRange, but stops once the data and
+// extensions of the logs would exceed maxBytes, and then reports the range
+// as truncated. The first log is always returned, so that a caller resumes
+// after the index of the last log returned. The read fallback isn't used.
+func (s *Sqlite3Store) GetLogRangeLimited(min, max uint64, maxBytes int64) (logs []*raft.Log, truncated bool, err error) {
+	s.beginRead()
+	defer s.endRead()
+	start := time.Now()
+	defer s.logIfSlow("GetLogRangeLimited()", start, "range=[%d, %d]", min, max)
+
+	query := fmt.Sprintf("select id, %s from %s where id >= ? and id <= ? order by id asc",
+		s.logColumns(), s.logTables())
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query, s.logKey(min), s.logKey(max))
+	if err != nil {
+		return nil, false, timeoutError(ctx, err)
+	}
+	defer rows.Close()
+
+	var size int64
+	for rows.Next() {
+		var (
+			id uint64
+			val, data []byte
+		)
+		if err := rows.Scan(&id, &val, &data); err != nil {
+			return nil, false, timeoutError(ctx, err)
+		}
+		log := new(raft.Log)
+		if err := s.decodeLog(val, data, log); err != nil {
+			return nil, false, fmt.Errorf("%w at index %d: %v", ErrDecode, id, err)
+		}
+		size += int64(len(log.Data) + len(log.Extensions))
+		if size > maxBytes && len(logs) > 0 {
+			return logs, true, nil
+		}
+		logs = append(logs, log)
+	}
+	return logs, false, timeoutError(ctx, rows.Err())
+}
+
+// GetLogs returns the logs at the given indexes in index order, skipping the
+// ones missing. The indexes are queried in chunks of "id in (...)" lists of
+// at most the limit of WithInClauseLimit.
+func (s *Sqlite3Store) GetLogs(indexes []uint64) ([]*raft.Log, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	limit := s.opts.inClauseLimit
+	var logs []*raft.Log
+	for len(indexes) > 0 {
+		n := len(indexes)
+		if n > limit {
+			n = limit
+		}
+		chunk := indexes[:n]
+		indexes = indexes[n:]
+
+		args := make([]interface{}, len(chunk))
+		for i, idx := range chunk {
+			args[i] = s.logKey(idx)
+		}
+		params := strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ")
+		query := s.logsQuery(fmt.Sprintf("where id in (%s)", params))
+		found, err := s.getLogsChunk(query, args)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, found...)
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].Index < logs[j].Index
+	})
+	return logs, nil
+}
+
+// getLogsChunk queries a chunk of the indexes of GetLogs, bounded by the
+// statement timeout on its own.
+func (s *Sqlite3Store) getLogsChunk(query string, args []interface{}) ([]*raft.Log, error) {
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	logs, err := s.scanLogs(rows)
+	return logs, timeoutError(ctx, err)
+}
+
+// GetLogWindow returns the logs within radius of center in index order, that
+// is within [center-radius, center+radius] clamped to the first and last
+// indexes of the store, without underflowing below index 1 or overflowing
+// the largest index sqlite3 holds. Like GetLogRange, only the logs present
+// are returned.
+func (s *Sqlite3Store) GetLogWindow(center, radius uint64) ([]*raft.Log, error) {
+	min, max := uint64(1), uint64(math.MaxInt64)
+	if center > radius {
+		min = center - radius
+	}
+	if radius < max && center < max-radius {
+		max = center + radius
+	}
+
+	// Clamp the window to the existing bounds
+	first, err := s.FirstIndex()
+	if err != nil {
+		return nil, err
+	}
+	last, err := s.LastIndex()
+	if err != nil {
+		return nil, err
+	}
+	if first == 0 {
+		return nil, nil
+	}
+	if min < first {
+		min = first
+	}
+	if max > last {
+		max = last
+	}
+	if min > max {
+		return nil, nil
+	}
+	return s.GetLogRange(min, max)
+}
+
+// HasLog returns true if the log at idx is present, without reading or
+// decoding its value.
+func (s *Sqlite3Store) HasLog(idx uint64) (bool, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	query := fmt.Sprintf("select 1 from %s where id = ? limit 1", dbLogs)
+	var one int
+	ctx, cancel := s.opContext()
+	defer cancel()
+	err := s.reader().QueryRowContext(ctx, query, s.logKey(idx)).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, timeoutError(ctx, err)
+	}
+	return true, nil
+}
+
+// IsEmpty returns true if the store holds no log, a log at index 0 reading
+// as an empty log like with FirstIndex and LastIndex.
+func (s *Sqlite3Store) IsEmpty() (bool, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	query := fmt.Sprintf("select 1 from %s where id >= ? limit 1", dbLogs)
+	var one int
+	ctx, cancel := s.opContext()
+	defer cancel()
+	err := s.reader().QueryRowContext(ctx, query, s.logKey(1)).Scan(&one)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, timeoutError(ctx, err)
+	}
+	return false, nil
+}
+
+// StoreLog is used to store a single raft log
+func (s *Sqlite3Store) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs is used to store a set of raft logs
+func (s *Sqlite3Store) StoreLogs(logs []*raft.Log) (err error) {
+	if err = s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+	start := time.Now()
+	defer s.logIfSlow("StoreLogs()", start, "logs=%d", len(logs))
+
+	// Try to do when busy
+	// @since 2019-06-11 little-pan
+	for retries := 0; ; retries++ {
+		if _, err = s.doStoreLogs(logs, "insert", nil); err != nil {
+			if s.waitIfBusy("StoreLogs()", err, 100 * time.Millisecond, start, retries) {
+				continue
+			}
+			return err
+		}
+		
+		s.postCommit(logs)
+		return nil
+	}
+}
+
+// StoreLogsIfAbsent is like StoreLogs, but skips the logs whose index is
+// already present instead of failing, without overwriting them, so that
+// overlapping batches can be stored again. It returns the number of logs
+// actually stored, and the post-commit hook only sees these.
+func (s *Sqlite3Store) StoreLogsIfAbsent(logs []*raft.Log) (stored uint64, err error) {
+	if err = s.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer s.endWrite()
+	start := time.Now()
+	defer s.logIfSlow("StoreLogsIfAbsent()", start, "logs=%d", len(logs))
+
+	for retries := 0; ; retries++ {
+		inserted, err := s.doStoreLogs(logs, "insert or ignore", nil)
+		if err != nil {
+			if s.waitIfBusy("StoreLogsIfAbsent()", err, 100 * time.Millisecond, start, retries) {
+				continue
+			}
+			return 0, err
+		}
+
+		s.postCommit(inserted)
+		return uint64(len(inserted)), nil
+	}
+}
+
+// AppendLog is like StoreLog, but also returns the last index of the store
+// once the log is stored, read in the same transaction.
+func (s *Sqlite3Store) AppendLog(log *raft.Log) (lastIndex uint64, err error) {
+	if err = s.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer s.endWrite()
+	start := time.Now()
+	defer s.logIfSlow("AppendLog()", start, "index=%d", log.Index)
+
+	logs := []*raft.Log{log}
+	for retries := 0; ; retries++ {
+		if _, err = s.doStoreLogs(logs, "insert", &lastIndex); err != nil {
+			if s.waitIfBusy("AppendLog()", err, 100 * time.Millisecond, start, retries) {
+				continue
+			}
+			return 0, err
+		}
+
+		s.postCommit(logs)
+		return lastIndex, nil
+	}
+}
+
+// panicError returns the error of the recovered panic m of a transaction
+// rolled back, holding m and the stack of the panic, or panics again with m
+// under WithRepanic.
+func (s *Sqlite3Store) panicError(m interface{}) error {
+	if s.opts.repanic {
+		panic(m)
+	}
+	return fmt.Errorf("%w: %v\n%s", ErrPanic, m, debug.Stack())
+}
+
+// postCommit trims the store to the max disk bytes, then calls the post-commit
+// hook with the index range of the committed logs. A trim error or a panic in
+// the hook is logged, as the logs are already committed.
+func (s *Sqlite3Store) postCommit(logs []*raft.Log) {
+	if err := s.trimToMaxDiskBytes(); err != nil {
+		s.logger.Printf("[WARN ] %s: trim to the max disk bytes %s", tag, err)
+	}
+	if err := s.checkpointEveryN(len(logs)); err != nil {
+		s.logger.Printf("[WARN ] %s: checkpoint every %d logs %s", tag, s.opts.checkpointEveryN, err)
+	}
+	hook := s.opts.postCommitHook
+	if hook == nil || len(logs) == 0 {
+		return
+	}
+	first, last := logs[0].Index, logs[0].Index
+	for _, log := range logs[1:] {
+		if log.Index < first {
+			first = log.Index
+		}
+		if log.Index > last {
+			last = log.Index
+		}
+	}
+
+	defer func(){
+		if m := recover(); m != nil {
+			s.logger.Printf("[ERROR] %s: post-commit hook of [%d, %d] panic: %v", tag, first, last, m)
+		}
+	}()
+	hook(first, last)
+}
+
+// doStoreLogs inserts the logs with the verb of newLogInserter, and returns
+// the ones inserted. The last index after the insert is read into last
+// unless it's nil.
+func (s *Sqlite3Store) doStoreLogs(logs []*raft.Log, verb string, last *uint64) (inserted []*raft.Log, err error) {
+	if s.opts.rejectIndexZero {
+		for _, log := range logs {
+			if log.Index == 0 {
+				return nil, ErrZeroIndex
+			}
+		}
+	}
+	if err = s.checkWALSizeLimit(); err != nil {
+		return nil, err
+	}
+	s.writeLimiter.wait()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	ctx, cancel := s.opContext()
+	defer cancel()
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return
+	}
+	defer func(){
+		err = timeoutError(ctx, err)
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if m := recover(); m != nil{
+			tx.Rollback()
+			err = s.panicError(m)
+		}
+	}()
+
+	if s.opts.rejectBelowBase {
+		if err = checkAboveBase(tx, logs); err != nil {
+			return nil, err
+		}
+	}
+	inserter, err := s.newLogInserter(ctx, tx, verb)
+	if err != nil {
+		return nil, err
+	}
+	defer inserter.Close()
+	
+	inserted = make([]*raft.Log, 0, len(logs))
+	for i, log := range logs {
+		ok, err := inserter.insert(log)
+		if errors.Is(err, ErrEncode) {
+			return nil, fmt.Errorf("%w, log %d of %d in the batch", err, i+1, len(logs))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			inserted = append(inserted, log)
+		}
+	}
+
+	if last != nil {
+		query := fmt.Sprintf("select coalesce(max(id), 0) from %s", dbLogs)
+		if err = tx.QueryRowContext(ctx, query).Scan(last); err != nil {
+			return nil, err
+		}
+	}
+	if err = s.mirrorStoreLogs(inserted); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.writeLimiter.take(inserter.bytes)
+	return inserted, nil
+}
+
+// logInserter inserts logs with the prepared statements of a transaction.
+type logInserter struct {
+	s *Sqlite3Store
+	ctx context.Context
+	stmt *sql.Stmt
+	// dataStmt inserts the log data with WithSplitData.
+	dataStmt *sql.Stmt
+	// bytes counts the encoded bytes inserted.
+	bytes int64
+}
+
+// newLogInserter prepares the statements of tx inserting logs under ctx, verb
+// is the insert clause such as "insert".
+func (s *Sqlite3Store) newLogInserter(ctx context.Context, tx *sql.Tx, verb string) (*logInserter, error) {
+	stmt, err := tx.PrepareContext(ctx, s.insertLogQuery(verb))
+	if err != nil {
+		return nil, err
+	}
+	inserter := &logInserter{s: s, ctx: ctx, stmt: stmt}
+	if s.opts.splitData {
+		query := fmt.Sprintf("%s into %s(id, data)values(?, ?)", verb, dbLogData)
+		if inserter.dataStmt, err = tx.PrepareContext(ctx, query); err != nil {
+			stmt.Close()
+			return nil, err
+		}
+	}
+	return inserter, nil
+}
+
+// insert encodes and inserts the log, and reports whether it was inserted,
+// which is false when an "insert or ignore" found it present.
+func (i *logInserter) insert(log *raft.Log) (bool, error) {
+	val, data, err := i.s.encodeLog(log)
+	if err != nil {
+		return false, fmt.Errorf("%w at index %d: %v", ErrEncode, log.Index, err)
+	}
+	if err := i.s.checkValueSize(len(val) + len(data)); err != nil {
+		return false, err
+	}
+
+	res, err := i.stmt.ExecContext(i.ctx, i.s.logArgs(log, val)...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if i.dataStmt != nil {
+		if _, err := i.dataStmt.ExecContext(i.ctx, i.s.logKey(log.Index), data); err != nil {
+			return false, err
+		}
+	}
+	i.bytes += int64(len(val) + len(data))
+	return true, nil
+}
+
+// Close closes the prepared statements.
+func (i *logInserter) Close() error {
+	if i.dataStmt != nil {
+		i.dataStmt.Close()
+	}
+	return i.stmt.Close()
+}
+
+// encodeLog encodes the log into the value of the logs table, and returns the
+// data to hold apart with WithSplitData.
+func (s *Sqlite3Store) encodeLog(log *raft.Log) (val, data []byte, err error) {
+	if s.opts.splitData {
+		meta := *log
+		meta.Data = nil
+		log, data = &meta, log.Data
+	}
+	if val, err = s.opts.codec.Encode(log); err != nil {
+		return nil, nil, err
+	}
+	if val, err = s.compress(val); err != nil {
+		return nil, nil, err
+	}
+	if data != nil {
+		if data, err = s.compress(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	if enc := s.opts.transformEnc; enc != nil {
+		if val, err = enc(val); err != nil {
+			return nil, nil, err
+		}
+		if data != nil {
+			if data, err = enc(data); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return val, data, nil
+}
+
+// decodeLog reverses encodeLog, data is nil unless held apart. The value is
+// decoded with the fallback codec if the codec fails.
+func (s *Sqlite3Store) decodeLog(val, data []byte, log *raft.Log) (err error) {
+	if dec := s.opts.transformDec; dec != nil {
+		if val, err = dec(val); err != nil {
+			return err
+		}
+		if data != nil {
+			if data, err = dec(data); err != nil {
+				return err
+			}
+		}
+	}
+	if val, err = s.decompress(val); err != nil {
+		return err
+	}
+	if data != nil {
+		if data, err = s.decompress(data); err != nil {
+			return err
+		}
+	}
+	if err := s.opts.codec.Decode(val, log); err != nil {
+		fallback := s.opts.fallbackCodec
+		if fallback == nil {
+			return err
+		}
+		*log = raft.Log{}
+		if fallback.Decode(val, log) != nil {
+			return err
+		}
+	}
+	if data != nil {
+		log.Data = data
+	}
+	return nil
+}
+
+// logsQuery returns the query selecting the value and data columns of the
+// logs matching cond, such as "where id = ?".
+func (s *Sqlite3Store) logsQuery(cond string) string {
+	return fmt.Sprintf("select %s from %s %s", s.logColumns(), s.logTables(), cond)
+}
+
+// logColumns returns the value and data columns of the logs.
+func (s *Sqlite3Store) logColumns() string {
+	if s.opts.splitData {
+		return "value, data"
+	}
+	return "value, null"
+}
+
+// logTables returns the tables of the logs, the log data being joined on id
+// with WithSplitData.
+func (s *Sqlite3Store) logTables() string {
+	if s.opts.splitData {
+		return fmt.Sprintf("%s left join %s using(id)", dbLogs, dbLogData)
+	}
+	return dbLogs
+}
+
+// checkValueSize returns ErrValueTooLarge if the value size exceeds the max value size.
+func (s *Sqlite3Store) checkValueSize(size int) error {
+	if max := s.opts.maxValueSize; max > 0 && size > max {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// insertLogQuery returns the statement inserting a log with its optional
+// columns, verb is the insert clause such as "insert".
+func (s *Sqlite3Store) insertLogQuery(verb string) string {
+	columns, params := "id, value", "?, ?"
+	if s.opts.termColumn {
+		columns, params = columns + ", term", params + ", ?"
+	}
+	if s.opts.typeColumn {
+		columns, params = columns + ", type", params + ", ?"
+	}
+	if s.opts.partition != nil {
+		columns, params = columns + ", partition_id", params + ", ?"
+	}
+	if s.opts.timestamps {
+		columns, params = columns + ", stored_at", params + ", ?"
+	}
+	return fmt.Sprintf("%s into %s(%s)values(%s)", verb, dbLogs, columns, params)
+}
+
+// logArgs returns the arguments of the insertLogQuery statement for the log
+// and its encoded value.
+func (s *Sqlite3Store) logArgs(log *raft.Log, val []byte) []interface{} {
+	args := []interface{}{s.logKey(log.Index), val}
+	if s.opts.termColumn {
+		args = append(args, log.Term)
+	}
+	if s.opts.typeColumn {
+		args = append(args, int(log.Type))
+	}
+	if s.opts.partition != nil {
+		args = append(args, s.opts.partition(log))
+	}
+	if s.opts.timestamps {
+		args = append(args, time.Now().UnixNano())
+	}
+	return args
+}
+
+// DeleteRange is used to delete logs within a given range inclusively.
+func (s *Sqlite3Store) DeleteRange(min, max uint64) error {
+	_, err := s.DeleteRangeN(min, max)
+	return err
+}
+
+// DeleteRangeN is like DeleteRange, but also returns the number of logs
+// actually deleted.
+func (s *Sqlite3Store) DeleteRangeN(min, max uint64) (uint64, error) {
+	if err := s.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer s.endWrite()
+	start := time.Now()
+	defer s.logIfSlow("DeleteRange()", start, "range=[%d, %d]", min, max)
+
+	// Delete range by batch for database locked issue
+	// @since 2019-06-11 little-pan
+	var n uint64
+	a, batch, retries := min, uint64(999), 0
+	for a <= max {
+		b := max
+		if max - a >= batch {
+			b = a + batch - 1
+		}
+		// The last batch raises the base index if the log was compacted
+		rows, err := s.doDeleteRange(a, b, b == max)
+		if err != nil {
+			if s.waitIfBusy("DeleteRange()", err, 250 * time.Millisecond, start, retries) {
+				retries++
+				continue
+			}
+			return n, err
+		}
+		n, retries = n + uint64(rows), 0
+
+		if b == max {
+			break
+		}
+		a = b + 1
+		if yield := s.opts.deleteYield; yield > 0 {
+			// Let the readers and checkpoints in
+			time.Sleep(yield)
+		}
+	}
+
+	return n, nil
+}
+
+// DeleteAll deletes all the logs, like DeleteRange over the whole log, and
+// returns the path of the backup taken before with WithPreDestructiveBackup,
+// "" without. The conf is kept.
+func (s *Sqlite3Store) DeleteAll() (backupPath string, err error) {
+	if backupPath, err = s.preDestructiveBackup("DeleteAll"); err != nil {
+		return "", err
+	}
+	first, err := s.FirstIndex()
+	if err != nil {
+		return backupPath, err
+	}
+	last, err := s.LastIndex()
+	if err != nil {
+		return backupPath, err
+	}
+	if last == 0 {
+		return backupPath, nil
+	}
+	_, err = s.DeleteRangeN(first, last)
+	return backupPath, err
+}
+
+// Vacuum rebuilds the database file to reclaim the space of the deleted logs,
+// and returns the path of the backup taken before with
+// WithPreDestructiveBackup, "" without. The writes wait meanwhile.
+func (s *Sqlite3Store) Vacuum() (backupPath string, err error) {
+	if err = s.beginWrite(); err != nil {
+		return "", err
+	}
+	defer s.endWrite()
+
+	if backupPath, err = s.preDestructiveBackup("Vacuum"); err != nil {
+		return "", err
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	_, err = s.db.Exec("vacuum")
+	return backupPath, err
+}
+
+// waitIfBusy returns true if err is a busy error, or one the retry classifier
+// retries, and the method should be retried, start is when the method started and retries the number of
+// retries so far. It sleeps before, unless the busy handler decides. With
+// WithWriteTimeout no retry starts after the write timeout since start.
+func (s *Sqlite3Store) waitIfBusy(method string, err error, sleep time.Duration, start time.Time, retries int) bool {
+	if s.isRetryable(err) {
+		if timeout := s.opts.writeTimeout; timeout > 0 {
+			left := timeout - time.Since(start)
+			if left <= 0 {
+				return false
+			}
+			if sleep > left {
+				sleep = left
+			}
+		}
+		if handler := s.opts.busyHandler; handler != nil {
+			if !handler(retries) {
+				return false
+			}
+			s.onRetry(method, retries, err)
+			atomic.AddUint64(&s.busyRetries, 1)
+			return true
+		}
+		// Try to do again when busy
+		s.logger.Printf("[WARN ] %s: %s %s, sleep %s then retry", tag, method, err, sleep)
+		s.onRetry(method, retries, err)
+		time.Sleep(sleep)
+		atomic.AddUint64(&s.busyRetries, 1)
+		return true
+	}
+	
+	return false
+}
+
+// onRetry calls the retry callback with the operation of method, the number
+// of the retry, counted from 1, and the error retried.
+func (s *Sqlite3Store) onRetry(method string, retries int, err error) {
+	if fn := s.opts.onRetry; fn != nil {
+		fn(strings.TrimSuffix(method, "()"), retries+1, err)
+	}
+}
+
+// isRetryable returns true if err is a busy or locked error, or an error the
+// retry classifier retries.
+func (s *Sqlite3Store) isRetryable(err error) bool {
+	if e, ok := err.(sqlite3.Error); ok && (e.Code == sqlite3.ErrLocked || e.Code == sqlite3.ErrBusy) {
+		return true
+	}
+	classifier := s.opts.retryClassifier
+	return classifier != nil && classifier(err)
+}
+
+// logIfSlow logs the method if it has taken longer than the slow log threshold
+// since start, the detail describes the sizes involved.
+func (s *Sqlite3Store) logIfSlow(method string, start time.Time, detail string, args ...interface{}) {
+	threshold := s.opts.slowLogThreshold
+	if threshold <= 0 {
+		return
+	}
+	if elapsed := time.Since(start); elapsed > threshold {
+		s.logger.Printf("[WARN ] %s: %s slow %s, %s", tag, method, elapsed, fmt.Sprintf(detail, args...))
+	}
+}
+
+// doDeleteRange deletes a batch of logs within the given range inclusively,
+// and with compact decides in the same transaction whether the deletion
+// compacted the log up to max.
+func (s *Sqlite3Store) doDeleteRange(min, max uint64, compact bool) (n int64, err error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	ctx, cancel := s.opContext()
+	defer cancel()
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func(){
+		err = timeoutError(ctx, err)
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	query := fmt.Sprintf("delete from %s where id >= ? and id <= ?", dbLogs)
+	res, err := tx.ExecContext(ctx, query, s.logKey(min), s.logKey(max))
+	if err != nil {
+		return 0, err
+	}
+	if n, err = res.RowsAffected(); err != nil {
+		return 0, err
+	}
+	if s.opts.splitData {
+		query = fmt.Sprintf("delete from %s where id >= ? and id <= ?", dbLogData)
+		if _, err = tx.ExecContext(ctx, query, s.logKey(min), s.logKey(max)); err != nil {
+			return 0, err
+		}
+	}
+	if compact {
+		if err = s.compactBase(ctx, tx, max); err != nil {
+			return 0, err
+		}
+	}
+	if err = s.mirrorDeleteRange(min, max); err != nil {
+		return 0, err
+	}
+	
+	return n, tx.Commit()
+}
+
+// GetLogsByTerm returns the logs of the given term in index order. It
+// requires WithTermColumn, otherwise ErrNotSupported is returned.
+func (s *Sqlite3Store) GetLogsByTerm(term uint64) ([]*raft.Log, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	if !s.opts.termColumn {
+		return nil, ErrNotSupported
+	}
+
+	query := s.logsQuery("where term = ? order by id asc")
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query, term)
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	logs, err := s.scanLogs(rows)
+	return logs, timeoutError(ctx, err)
+}
+
+// GetLogsByType returns the logs of type t within the given range inclusively
+// in index order, e.g. the configuration changes. It requires WithTypeColumn,
+// otherwise ErrNotSupported is returned.
+func (s *Sqlite3Store) GetLogsByType(t raft.LogType, min, max uint64) ([]*raft.Log, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	if !s.opts.typeColumn {
+		return nil, ErrNotSupported
+	}
+
+	query := s.logsQuery("where type = ? and id >= ? and id <= ? order by id asc")
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query, int(t), s.logKey(min), s.logKey(max))
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	logs, err := s.scanLogs(rows)
+	return logs, timeoutError(ctx, err)
+}
+
+// GetLogsByPartition returns the logs of partition p within the given range
+// inclusively in index order. It requires WithPartitionColumn, otherwise
+// ErrNotSupported is returned.
+func (s *Sqlite3Store) GetLogsByPartition(p int64, min, max uint64) ([]*raft.Log, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	if s.opts.partition == nil {
+		return nil, ErrNotSupported
+	}
+
+	query := s.logsQuery("where partition_id = ? and id >= ? and id <= ? order by id asc")
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query, p, s.logKey(min), s.logKey(max))
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	logs, err := s.scanLogs(rows)
+	return logs, timeoutError(ctx, err)
+}
+
+// GetLogsPageWithTotal returns at most limit logs after afterIndex in index
+// order, along with the total number of logs, both read in one transaction
+// so that they agree.
+func (s *Sqlite3Store) GetLogsPageWithTotal(afterIndex uint64, limit int) (logs []*raft.Log, total uint64, err error) {
+	s.beginRead()
+	defer s.endRead()
+
+	ctx, cancel := s.opContext()
+	defer cancel()
+	tx, err := s.reader().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, timeoutError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	query := s.logsQuery("where id > ? order by id asc limit ?")
+	rows, err := tx.QueryContext(ctx, query, s.logKey(afterIndex), limit)
+	if err != nil {
+		return nil, 0, timeoutError(ctx, err)
+	}
+	if logs, err = s.scanLogs(rows); err != nil {
+		return nil, 0, timeoutError(ctx, err)
+	}
+	query = fmt.Sprintf("select count(*) from %s", dbLogs)
+	if err = tx.QueryRowContext(ctx, query).Scan(&total); err != nil {
+		return nil, 0, timeoutError(ctx, err)
+	}
+	return logs, total, nil
+}
+
+// PresentRanges returns the runs of consecutive indexes present in the log,
+// as [start, end] inclusive pairs in index order, nil for an empty log.
+func (s *Sqlite3Store) PresentRanges() ([][2]uint64, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	// The indexes of a run have the same difference to their row number
+	query := fmt.Sprintf("select min(id), max(id) from (select id, id - row_number() over (order by id) as run"+
+		" from %s) group by run order by 1", dbLogs)
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query)
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	defer rows.Close()
+
+	var ranges [][2]uint64
+	for rows.Next() {
+		var r [2]uint64
+		if err := rows.Scan(&r[0], &r[1]); err != nil {
+			return nil, timeoutError(ctx, err)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, timeoutError(ctx, rows.Err())
+}
+
+// SelfCheck verifies that the logs at the first and last indexes can be read
+// unless the log is empty, a cheap invariant check before trusting the store.
+func (s *Sqlite3Store) SelfCheck() error {
+	first, err := s.FirstIndex()
+	if err != nil {
+		return err
+	}
+	last, err := s.LastIndex()
+	if err != nil {
+		return err
+	}
+	if first == 0 && last == 0 {
+		return nil
+	}
+	if first == 0 || last < first {
+		return fmt.Errorf("self check: bad index range [%d, %d]", first, last)
+	}
+	if err := s.GetLog(first, new(raft.Log)); err != nil {
+		return fmt.Errorf("self check: first index %d: %w", first, err)
+	}
+	if err := s.GetLog(last, new(raft.Log)); err != nil {
+		return fmt.Errorf("self check: last index %d: %w", last, err)
+	}
+	return nil
+}
+
+// GrowthSince returns the number of logs stored since t and their total byte
+// length, the log data held apart included. It requires WithTimestamps, else
+// it returns ErrNotSupported; the logs stored before aren't counted.
+func (s *Sqlite3Store) GrowthSince(t time.Time) (entries uint64, bytes uint64, err error) {
+	if !s.opts.timestamps {
+		return 0, 0, ErrNotSupported
+	}
+
+	size := "length(value)"
+	if s.opts.splitData {
+		size += " + coalesce(length(data), 0)"
+	}
+	query := fmt.Sprintf("select count(*), coalesce(sum(%s), 0) from %s where stored_at >= ?",
+		size, s.logTables())
+	ctx, cancel := s.opContext()
+	defer cancel()
+	err = s.reader().QueryRowContext(ctx, query, unixNano(t)).Scan(&entries, &bytes)
+	return entries, bytes, timeoutError(ctx, err)
+}
+
+// GetLogsInTimeRange returns the logs stored between from and to inclusively
+// in index order, a zero from or to leaving the range open on its side. It
+// requires WithTimestamps, else it returns ErrNotSupported; the logs stored
+// before have no time and aren't returned.
+func (s *Sqlite3Store) GetLogsInTimeRange(from, to time.Time) ([]*raft.Log, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	if !s.opts.timestamps {
+		return nil, ErrNotSupported
+	}
+
+	end := int64(math.MaxInt64)
+	if !to.IsZero() {
+		end = to.UnixNano()
+	}
+	query := s.logsQuery("where stored_at >= ? and stored_at <= ? order by id asc")
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query, unixNano(from), end)
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+	logs, err := s.scanLogs(rows)
+	return logs, timeoutError(ctx, err)
+}
+
+// TimeSpan returns the oldest and newest times the logs were stored at, or
+// zero times if no log has one. It requires WithTimestamps, else it returns
+// ErrNotSupported; the logs stored before have no time and aren't counted.
+func (s *Sqlite3Store) TimeSpan() (oldest, newest time.Time, err error) {
+	if !s.opts.timestamps {
+		return time.Time{}, time.Time{}, ErrNotSupported
+	}
+
+	var min, max sql.NullInt64
+	query := fmt.Sprintf("select min(stored_at), max(stored_at) from %s", dbLogs)
+	ctx, cancel := s.opContext()
+	defer cancel()
+	if err := s.reader().QueryRowContext(ctx, query).Scan(&min, &max); err != nil {
+		return time.Time{}, time.Time{}, timeoutError(ctx, err)
+	}
+	if !min.Valid {
+		return time.Time{}, time.Time{}, nil
+	}
+	return time.Unix(0, min.Int64), time.Unix(0, max.Int64), nil
+}
+
+// EstimateTimeToFull projects when the database and its WAL file reach
+// limitBytes on disk, at the rate the log bytes grew over the last window as
+// measured by GrowthSince. It returns zero if the limit is already reached,
+// and ErrNeverFull if the logs didn't grow over the window. It requires
+// WithTimestamps, else it returns ErrNotSupported.
+func (s *Sqlite3Store) EstimateTimeToFull(limitBytes int64, window time.Duration) (time.Duration, error) {
+	if window <= 0 {
+		return 0, fmt.Errorf("invalid window %s", window)
+	}
+	_, grown, err := s.GrowthSince(time.Now().Add(-window))
+	if err != nil {
+		return 0, err
+	}
+	st, err := s.Stats()
+	if err != nil {
+		return 0, err
+	}
+	left := limitBytes - st.DBSize - st.WALSize
+	if left <= 0 {
+		return 0, nil
+	}
+	if grown == 0 {
+		return 0, ErrNeverFull
+	}
+	rate := float64(grown) / float64(window)
+	return time.Duration(float64(left) / rate), nil
+}
+
+// RangeChecksum returns the FNV-1a hash of the ordered (id, value) pairs of the
+// logs within the given range inclusively. Two stores holding identical logs
+// in the range have the same checksum.
+func (s *Sqlite3Store) RangeChecksum(min, max uint64) (uint64, error) {
+	s.beginRead()
+	defer s.endRead()
+
+	query := fmt.Sprintf("select id, %s from %s where id >= ? and id <= ? order by id asc",
+		s.logColumns(), s.logTables())
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query, s.logKey(min), s.logKey(max))
+	if err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	defer rows.Close()
+
+	h := fnv.New64a()
+	for rows.Next() {
+		var (
+			id uint64
+			val, data []byte
+		)
+		if err := rows.Scan(&id, &val, &data); err != nil {
+			return 0, timeoutError(ctx, err)
+		}
+		h.Write(uint64ToBytes(id))
+		h.Write(val)
+		h.Write(data)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	return h.Sum64(), nil
+}
+
+// MaxValueSize returns the index and the byte length of the largest stored
+// log value, or zeros for an empty log.
+func (s *Sqlite3Store) MaxValueSize() (idx uint64, size int, err error) {
+	query := fmt.Sprintf("select id, length(value) from %s order by length(value) desc limit 1", dbLogs)
+	if s.opts.splitData {
+		query = fmt.Sprintf("select id, length(value) + coalesce(length(data), 0) as size"+
+			" from %s order by size desc limit 1", s.logTables())
+	}
+	ctx, cancel := s.opContext()
+	defer cancel()
+	err = s.reader().QueryRowContext(ctx, query).Scan(&idx, &size)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	return idx, size, timeoutError(ctx, err)
+}
+
+// LogicalLogBytes returns the total byte length of the stored log values,
+// the log data held apart included. Compared to the size of the database
+// file it tells the storage overhead.
+func (s *Sqlite3Store) LogicalLogBytes() (uint64, error) {
+	// Read in a transaction, to sum a consistent snapshot of both tables
+	ctx, cancel := s.opContext()
+	defer cancel()
+	tx, err := s.reader().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	defer tx.Rollback()
+
+	var size, dataSize uint64
+	query := fmt.Sprintf("select coalesce(sum(length(value)), 0) from %s", dbLogs)
+	if err := tx.QueryRowContext(ctx, query).Scan(&size); err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	if s.opts.splitData {
+		query = fmt.Sprintf("select coalesce(sum(length(data)), 0) from %s", dbLogData)
+		if err := tx.QueryRowContext(ctx, query).Scan(&dataSize); err != nil {
+			return 0, timeoutError(ctx, err)
+		}
+	}
+	return size + dataSize, nil
+}
+
+// scanLogs decodes the logs from the value and data columns of rows selected
+// by logsQuery, and closes rows.
+func (s *Sqlite3Store) scanLogs(rows *sql.Rows) ([]*raft.Log, error) {
+	defer rows.Close()
+
+	var logs []*raft.Log
+	for rows.Next() {
+		var val, data []byte
+		if err := rows.Scan(&val, &data); err != nil {
+			return nil, err
+		}
+		log := new(raft.Log)
+		if err := s.decodeLog(val, data, log); err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// Set is used to set a key/value set outside of the raft log
+func (s *Sqlite3Store) Set(k, v []byte) error {
+	if err := s.beginWrite(); err != nil {
+		return err
+	}
+	defer s.endWrite()
+
+	if err := s.checkValueSize(len(v)); err != nil {
+		return err
+	}
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	query := s.setConfQuery()
+	ctx, cancel := s.opContext()
+	defer cancel()
+	if s.opts.mirror != nil {
+		return timeoutError(ctx, s.setMirrored(ctx, query, k, v))
+	}
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return timeoutError(ctx, err)
+	}
+	defer stmt.Close()
+	
+	if _, err := stmt.ExecContext(ctx, k, v); err != nil {
+		return timeoutError(ctx, err)
+	}
+	
+	return nil
+}
+
+// setMirrored sets the key to the value with the query, in a transaction
+// committed once the mirror is set too.
+func (s *Sqlite3Store) setMirrored(ctx context.Context, query string, k, v []byte) (err error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, query, k, v); err != nil {
+		return err
+	}
+	if err = s.mirrorSet(k, v); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Get is used to retrieve a value from the k/v store by key
 func (s *Sqlite3Store) Get(k []byte) ([]byte, error) {
+	s.beginRead()
+	defer s.endRead()
+
 	query := fmt.Sprintf("select value from %s where id = ?", dbConf)
-	stmt, err := s.db.Prepare(query)
+	ctx, cancel := s.opContext()
+	defer cancel()
+	stmt, err := s.reader().PrepareContext(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, timeoutError(ctx, err)
 	}
 	defer stmt.Close()
 	
 	var val []byte
-	row := stmt.QueryRow(k)
+	row := stmt.QueryRowContext(ctx, k)
 	err = row.Scan(&val)
 	if err == sql.ErrNoRows {
 		return  nil, ErrKeyNotFound
 	}
 	if err != nil {
-		return nil, err
+		return nil, timeoutError(ctx, err)
 	}
 	
 	return append([]byte(nil), val...), nil
@@ -336,3 +2142,115 @@ func (s *Sqlite3Store) GetUint64(key []byte) (uint64, error) {
 	}
 	return bytesToUint64(val), nil
 }
+
+// IncrementUint64 adds delta to the uint64 value of key, set to delta if the
+// key is missing, and returns the new value. The read and the write are done
+// in one transaction, so that concurrent increments don't lose any.
+func (s *Sqlite3Store) IncrementUint64(key []byte, delta uint64) (val uint64, err error) {
+	if err = s.beginWrite(); err != nil {
+		return 0, err
+	}
+	defer s.endWrite()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	ctx, cancel := s.opContext()
+	defer cancel()
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var old []byte
+	query := fmt.Sprintf("select value from %s where id = ?", dbConf)
+	err = tx.QueryRowContext(ctx, query, key).Scan(&old)
+	switch {
+	case err == sql.ErrNoRows:
+		val = delta
+	case err != nil:
+		return 0, timeoutError(ctx, err)
+	default:
+		val = bytesToUint64(old) + delta
+	}
+	if _, err = tx.ExecContext(ctx, s.setConfQuery(), key, uint64ToBytes(val)); err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	if err = s.mirrorSet(key, uint64ToBytes(val)); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	return val, nil
+}
+
+// SetString is like Set, but handles string values
+func (s *Sqlite3Store) SetString(key []byte, val string) error {
+	return s.Set(key, []byte(val))
+}
+
+// GetString is like Get, but handles string values
+func (s *Sqlite3Store) GetString(key []byte) (string, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return string(val), nil
+}
+
+// SetBool is like Set, but handles bool values
+func (s *Sqlite3Store) SetBool(key []byte, val bool) error {
+	return s.Set(key, boolToBytes(val))
+}
+
+// GetBool is like Get, but handles bool values
+func (s *Sqlite3Store) GetBool(key []byte) (bool, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return false, err
+	}
+	return bytesToBool(val), nil
+}
+
+// LagBetween returns the signed difference of the uint64 values of keyA and
+// keyB, e.g. of the committed and applied indexes, read at once. A missing
+// key is an ErrKeyNotFound, or 0 with WithLagMissingAsZero.
+func (s *Sqlite3Store) LagBetween(keyA, keyB []byte) (int64, error) {
+	query := fmt.Sprintf("select id, value from %s where id in (?, ?)", dbConf)
+	ctx, cancel := s.opContext()
+	defer cancel()
+	rows, err := s.reader().QueryContext(ctx, query, keyA, keyB)
+	if err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	defer rows.Close()
+
+	var (
+		a, b           uint64
+		foundA, foundB bool
+	)
+	for rows.Next() {
+		var k, val []byte
+		if err := rows.Scan(&k, &val); err != nil {
+			return 0, timeoutError(ctx, err)
+		}
+		if bytes.Equal(k, keyA) {
+			a, foundA = bytesToUint64(val), true
+		}
+		if bytes.Equal(k, keyB) {
+			b, foundB = bytesToUint64(val), true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, timeoutError(ctx, err)
+	}
+	if (!foundA || !foundB) && !s.opts.lagMissingAsZero {
+		return 0, ErrKeyNotFound
+	}
+	return int64(a - b), nil
+}
@@ -2,19 +2,26 @@ package raftsqlite3
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"io/ioutil"
 	"fmt"
+	"log"
+	"math"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mattn/go-sqlite3"
 	"github.com/hashicorp/raft"
 	"github.com/little-pan/raft-sqlite3"
 )
 
-func testSqlite3Store(t testing.TB) (*raftsqlite3.Sqlite3Store, string) {
+func testSqlite3Store(t testing.TB, opts ...raftsqlite3.Option) (*raftsqlite3.Sqlite3Store, string) {
 	fh, err := ioutil.TempFile("", "sqlite3.db")
 	if err != nil {
 		t.Fatalf("err: %s", err)
@@ -23,7 +30,7 @@ func testSqlite3Store(t testing.TB) (*raftsqlite3.Sqlite3Store, string) {
 	
 	// Successfully creates and returns a store
 	path := fh.Name()
-	store, err := raftsqlite3.NewSqlite3Store(path)
+	store, err := raftsqlite3.NewSqlite3Store(path, opts...)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -217,6 +224,100 @@ func TestSqlite3Store_LastIndex(t *testing.T) {
 	}
 }
 
+func TestSqlite3Store_GetLogMeta(t *testing.T) {
+	for _, opts := range [][]raftsqlite3.Option{
+		nil,
+		{raftsqlite3.WithTermColumn(), raftsqlite3.WithTypeColumn()},
+	} {
+		store, path := testSqlite3Store(t, opts...)
+		defer store.Close()
+		defer os.Remove(path)
+
+		log := &raft.Log{Index: 3, Term: 2, Type: raft.LogConfiguration, Data: []byte("conf")}
+		if err := store.StoreLog(log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		index, term, typ, err := store.GetLogMeta(3)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if index != 3 || term != 2 || typ != raft.LogConfiguration {
+			t.Fatalf("bad: %d, %d, %s", index, term, typ)
+		}
+		if _, _, _, err := store.GetLogMeta(4); err != raft.ErrLogNotFound {
+			t.Fatalf("expected not found error, got: %v", err)
+		}
+	}
+}
+
+func TestSqlite3Store_IndexZero(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// The log at index 0 reads as an empty log
+	if err := store.StoreLog(testRaftLog(0, "log0")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if first, err := store.FirstIndex(); err != nil || first != 0 {
+		t.Fatalf("bad: %d, %v", first, err)
+	}
+	if last, err := store.LastIndex(); err != nil || last != 0 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+	if empty, err := store.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+	if st, err := store.Stats(); err != nil || st.LogCount != 0 || st.FirstIndex != 0 || st.LastIndex != 0 {
+		t.Fatalf("bad: %+v, %v", st, err)
+	}
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if first, err := store.FirstIndex(); err != nil || first != 1 {
+		t.Fatalf("bad: %d, %v", first, err)
+	}
+	if last, err := store.LastIndex(); err != nil || last != 2 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+	if empty, err := store.IsEmpty(); err != nil || empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+	if st, err := store.Stats(); err != nil || st.LogCount != 2 || st.FirstIndex != 1 || st.LastIndex != 2 {
+		t.Fatalf("bad: %+v, %v", st, err)
+	}
+
+	strict, path2 := testSqlite3Store(t, raftsqlite3.WithRejectIndexZero())
+	defer strict.Close()
+	defer os.Remove(path2)
+	err := strict.StoreLogs([]*raft.Log{testRaftLog(0, "log0"), testRaftLog(1, "log1")})
+	if err != raftsqlite3.ErrZeroIndex {
+		t.Fatalf("expected zero index error, got: %v", err)
+	}
+	if empty, err := strict.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+}
+
+func TestSqlite3Store_NextIndex(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Should get 1 on empty log
+	if next, err := store.NextIndex(); err != nil || next != 1 {
+		t.Fatalf("bad: %d, %v", next, err)
+	}
+
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if next, err := store.NextIndex(); err != nil || next != 3 {
+		t.Fatalf("bad: %d, %v", next, err)
+	}
+}
+
 func TestSqlite3Store_GetLog(t *testing.T) {
 	store, path := testSqlite3Store(t)
 	defer store.Close()
@@ -248,6 +349,185 @@ func TestSqlite3Store_GetLog(t *testing.T) {
 	}
 }
 
+func TestSqlite3Store_ReadFallback(t *testing.T) {
+	fb := raft.NewInmemStore()
+	old := []*raft.Log{testRaftLog(1, "old1"), testRaftLog(2, "old2"), testRaftLog(3, "old3")}
+	if err := fb.StoreLogs(old); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store, path := testSqlite3Store(t, raftsqlite3.WithReadFallback(fb))
+	defer store.Close()
+	defer os.Remove(path)
+
+	logs := []*raft.Log{testRaftLog(3, "log3"), testRaftLog(4, "log4"), testRaftLog(5, "log5")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result := new(raft.Log)
+	if err := store.GetLog(1, result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, old[0]) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if err := store.GetLog(3, result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, logs[0]) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if err := store.GetLog(9, result); err != raft.ErrLogNotFound {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+
+	all, err := store.GetLogRange(1, 6)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(all, []*raft.Log{old[0], old[1], logs[0], logs[1], logs[2]}) {
+		t.Fatalf("bad: %#v", all)
+	}
+
+	// The fill is bounded by the indexes of both stores
+	all, err = store.GetLogRange(1, math.MaxInt64)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(all, []*raft.Log{old[0], old[1], logs[0], logs[1], logs[2]}) {
+		t.Fatalf("bad: %#v", all)
+	}
+
+	// The writes don't go to the fallback
+	if first, err := store.FirstIndex(); err != nil || first != 3 {
+		t.Fatalf("bad: %d, %v", first, err)
+	}
+	if err := store.DeleteRange(3, 5); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if last, err := fb.LastIndex(); err != nil || last != 3 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+}
+
+func TestSqlite3Store_GetLogRangeLimited(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, strings.Repeat("x", 100)))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Resumes after the last log returned
+	var result []*raft.Log
+	for min := uint64(1); ; {
+		batch, truncated, err := store.GetLogRangeLimited(min, 10, 350)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(batch) != 3 && (truncated || len(batch) != 1) {
+			t.Fatalf("bad: %d, %t", len(batch), truncated)
+		}
+		result = append(result, batch...)
+		if !truncated {
+			break
+		}
+		min = batch[len(batch)-1].Index + 1
+	}
+	if !reflect.DeepEqual(result, logs) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// A log larger than the limit is still returned
+	batch, truncated, err := store.GetLogRangeLimited(1, 10, 10)
+	if err != nil || len(batch) != 1 || !truncated {
+		t.Fatalf("bad: %d, %t, %v", len(batch), truncated, err)
+	}
+}
+
+func TestSqlite3Store_GetLogs(t *testing.T) {
+	for _, opts := range [][]raftsqlite3.Option{
+		nil,
+		{raftsqlite3.WithInClauseLimit(7)},
+	} {
+		store, path := testSqlite3Store(t, opts...)
+		var logs []*raft.Log
+		for i := uint64(1); i <= 2500; i++ {
+			logs = append(logs, testRaftLog(i, fmt.Sprintf("log%d", i)))
+		}
+		if err := store.StoreLogs(logs); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// More indexes than the limit, some missing, out of order
+		var indexes []uint64
+		for i := uint64(3000); i >= 1; i-- {
+			if i%3 != 0 {
+				indexes = append(indexes, i)
+			}
+		}
+		result, err := store.GetLogs(indexes)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var expected []*raft.Log
+		for _, log := range logs {
+			if log.Index%3 != 0 {
+				expected = append(expected, log)
+			}
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("bad: %d logs", len(result))
+		}
+		store.Close()
+		os.Remove(path)
+	}
+
+	if _, err := raftsqlite3.New(":memory:", raftsqlite3.WithInClauseLimit(0)); err == nil {
+		t.Fatalf("expected invalid limit error")
+	}
+}
+
+func TestSqlite3Store_GetLogWindow(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, fmt.Sprintf("log%d", i)))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, c := range []struct {
+		center, radius uint64
+		expected       []*raft.Log
+	}{
+		{5, 2, logs[2:7]},
+		{2, 5, logs[:7]},
+		{9, 3, logs[5:]},
+		{5, 0, logs[4:5]},
+		{math.MaxUint64, 1, nil},
+		{1, math.MaxUint64, logs},
+		{20, 5, nil},
+	} {
+		result, err := store.GetLogWindow(c.center, c.radius)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(result, c.expected) {
+			t.Fatalf("%d, %d: bad: %#v", c.center, c.radius, result)
+		}
+	}
+}
+
 func TestSqlite3Store_SetLog(t *testing.T) {
 	store, path := testSqlite3Store(t)
 	defer store.Close()
@@ -391,3 +671,1792 @@ func TestSqlite3Store_SetUint64_GetUint64(t *testing.T) {
 		t.Fatalf("bad: %v", val)
 	}
 }
+
+func TestSqlite3Store_IncrementUint64(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	key := []byte("seq")
+	if val, err := store.IncrementUint64(key, 5); err != nil || val != 5 {
+		t.Fatalf("bad: %d, %v", val, err)
+	}
+
+	// Concurrent increments don't lose any
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := store.IncrementUint64(key, 1); err != nil {
+					t.Errorf("err: %s", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if val, err := store.GetUint64(key); err != nil || val != 105 {
+		t.Fatalf("bad: %d, %v", val, err)
+	}
+}
+
+func TestSqlite3Store_Drain(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Writes succeed before draining
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Drain with nothing in flight returns immediately
+	if err := store.Drain(context.Background()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// New writes are rejected once draining
+	if err := store.StoreLog(testRaftLog(2, "log2")); err != raftsqlite3.ErrDraining {
+		t.Fatalf("expected draining error, got: %v", err)
+	}
+	if err := store.Set([]byte("k"), []byte("v")); err != raftsqlite3.ErrDraining {
+		t.Fatalf("expected draining error, got: %v", err)
+	}
+	if err := store.DeleteRange(1, 1); err != raftsqlite3.ErrDraining {
+		t.Fatalf("expected draining error, got: %v", err)
+	}
+
+	// Reads still work
+	if err := store.GetLog(1, new(raft.Log)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSqlite3Store_BeginError(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+	store.Close()
+
+	err := store.StoreLog(testRaftLog(1, "log1"))
+	if !errors.Is(err, raftsqlite3.ErrStoreClosed) {
+		t.Fatalf("expected store closed error, got: %v", err)
+	}
+	if errors.Is(err, raftsqlite3.ErrDiskIO) {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestSqlite3Store_SlowLogThreshold(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	store, path := testSqlite3Store(t,
+		raftsqlite3.WithLogger(logger),
+		raftsqlite3.WithSlowLogThreshold(time.Nanosecond))
+	defer store.Close()
+	defer os.Remove(path)
+
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(buf.String(), "StoreLogs() slow") {
+		t.Fatalf("expected slow log, got: %q", buf.String())
+	}
+	buf.Reset()
+	if _, err := store.GetLogRange(1, 1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(buf.String(), "GetLogRange() slow") {
+		t.Fatalf("expected slow log, got: %q", buf.String())
+	}
+	buf.Reset()
+	if _, _, err := store.GetLogRangeLimited(1, 1, 1024); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(buf.String(), "GetLogRangeLimited() slow") {
+		t.Fatalf("expected slow log, got: %q", buf.String())
+	}
+
+	// Zero disables slow logging
+	buf.Reset()
+	store2, path2 := testSqlite3Store(t, raftsqlite3.WithLogger(logger))
+	defer store2.Close()
+	defer os.Remove(path2)
+
+	if err := store2.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if strings.Contains(buf.String(), "slow") {
+		t.Fatalf("unexpected slow log: %q", buf.String())
+	}
+}
+
+func TestSqlite3Store_GetLogsByTerm(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+
+	// Not supported without the term column
+	if _, err := store.GetLogsByTerm(1); err != raftsqlite3.ErrNotSupported {
+		t.Fatalf("expected not supported error, got: %v", err)
+	}
+
+	// Logs stored before the column existed
+	logs := []*raft.Log{
+		&raft.Log{Index: 1, Term: 1, Data: []byte("log1")},
+		&raft.Log{Index: 2, Term: 2, Data: []byte("log2")},
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	store, err := raftsqlite3.New(path, raftsqlite3.WithTermColumn())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+
+	more := []*raft.Log{
+		&raft.Log{Index: 3, Term: 2, Data: []byte("log3")},
+		&raft.Log{Index: 4, Term: 3, Data: []byte("log4")},
+	}
+	if err := store.StoreLogs(more); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result, err := store.GetLogsByTerm(2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, []*raft.Log{logs[1], more[0]}) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// No logs of the term
+	result, err = store.GetLogsByTerm(9)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(result) != 0 {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestSqlite3Store_GetLogsByType(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+
+	// Not supported without the type column
+	if _, err := store.GetLogsByType(raft.LogConfiguration, 1, 10); err != raftsqlite3.ErrNotSupported {
+		t.Fatalf("expected not supported error, got: %v", err)
+	}
+
+	// Logs stored before the column existed
+	logs := []*raft.Log{
+		&raft.Log{Index: 1, Type: raft.LogConfiguration, Data: []byte("conf1")},
+		&raft.Log{Index: 2, Type: raft.LogCommand, Data: []byte("log2")},
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	store, err := raftsqlite3.New(path, raftsqlite3.WithTypeColumn())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+
+	more := []*raft.Log{
+		&raft.Log{Index: 3, Type: raft.LogNoop},
+		&raft.Log{Index: 4, Type: raft.LogConfiguration, Data: []byte("conf4")},
+	}
+	if err := store.StoreLogs(more); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result, err := store.GetLogsByType(raft.LogConfiguration, 1, 4)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, []*raft.Log{logs[0], more[1]}) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result, err = store.GetLogsByType(raft.LogConfiguration, 2, 3); err != nil || len(result) != 0 {
+		t.Fatalf("bad: %#v, %v", result, err)
+	}
+}
+
+func TestSqlite3Store_GetLogsByPartition(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+
+	// Not supported without the partition column
+	if _, err := store.GetLogsByPartition(1, 1, 10); err != raftsqlite3.ErrNotSupported {
+		t.Fatalf("expected not supported error, got: %v", err)
+	}
+
+	// Logs stored before the column existed
+	logs := []*raft.Log{
+		&raft.Log{Index: 1, Data: []byte{1, 'a'}},
+		&raft.Log{Index: 2, Data: []byte{2, 'b'}},
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	partition := func(log *raft.Log) int64 {
+		return int64(log.Data[0])
+	}
+	store, err := raftsqlite3.New(path, raftsqlite3.WithPartitionColumn(partition))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+
+	more := []*raft.Log{
+		&raft.Log{Index: 3, Data: []byte{1, 'c'}},
+		&raft.Log{Index: 4, Data: []byte{2, 'd'}},
+		&raft.Log{Index: 5, Data: []byte{1, 'e'}},
+	}
+	if err := store.StoreLogs(more); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	result, err := store.GetLogsByPartition(1, 1, 4)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, []*raft.Log{logs[0], more[0]}) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if result, err = store.GetLogsByPartition(3, 1, 5); err != nil || len(result) != 0 {
+		t.Fatalf("bad: %#v, %v", result, err)
+	}
+}
+
+func TestSqlite3Store_MaxValueSize(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithMaxValueSize(64))
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Small values are stored
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Set([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Large values are rejected, along with the rest of the batch
+	big := strings.Repeat("x", 128)
+	logs := []*raft.Log{
+		testRaftLog(2, "log2"),
+		testRaftLog(3, big),
+	}
+	if err := store.StoreLogs(logs); err != raftsqlite3.ErrValueTooLarge {
+		t.Fatalf("expected value too large error, got: %v", err)
+	}
+	if err := store.GetLog(2, new(raft.Log)); err != raft.ErrLogNotFound {
+		t.Fatalf("expected raft log not found error, got: %v", err)
+	}
+	if err := store.Set([]byte("k"), []byte(big)); err != raftsqlite3.ErrValueTooLarge {
+		t.Fatalf("expected value too large error, got: %v", err)
+	}
+}
+
+func TestSqlite3Store_RangeChecksum(t *testing.T) {
+	store1, path1 := testSqlite3Store(t)
+	defer store1.Close()
+	defer os.Remove(path1)
+	store2, path2 := testSqlite3Store(t)
+	defer store2.Close()
+	defer os.Remove(path2)
+
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+		testRaftLog(3, "log3"),
+	}
+	if err := store1.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	logs[2] = testRaftLog(3, "bad3")
+	if err := store2.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Identical logs have the same checksum
+	sum1, err := store1.RangeChecksum(1, 2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum2, err := store2.RangeChecksum(1, 2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if sum1 != sum2 {
+		t.Fatalf("bad: %x != %x", sum1, sum2)
+	}
+
+	// Diverged logs don't
+	sum1, err = store1.RangeChecksum(1, 3)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	sum2, err = store2.RangeChecksum(1, 3)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if sum1 == sum2 {
+		t.Fatalf("bad: %x == %x", sum1, sum2)
+	}
+}
+
+func TestSqlite3Store_MmapSizeReadOnly(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	const mmapSize = 1 << 20
+	dsn := fmt.Sprintf("%s?_query_only=true", path)
+	roStore, err := raftsqlite3.New(dsn, raftsqlite3.WithMmapSize(mmapSize))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer roStore.Close()
+
+	// The pragma is applied even though the read-only store skips initialize
+	var size int64
+	if err := roStore.DB().QueryRow("pragma mmap_size").Scan(&size); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if size != mmapSize {
+		t.Fatalf("bad: %d", size)
+	}
+	if err := roStore.GetLog(1, new(raft.Log)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSqlite3Store_PostCommitHook(t *testing.T) {
+	var ranges [][2]uint64
+	hook := func(first, last uint64) {
+		ranges = append(ranges, [2]uint64{first, last})
+		panic("hook failure")
+	}
+	store, path := testSqlite3Store(t,
+		raftsqlite3.WithLogger(log.New(ioutil.Discard, "", 0)),
+		raftsqlite3.WithPostCommitHook(hook))
+	defer store.Close()
+	defer os.Remove(path)
+
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, "log2"),
+		testRaftLog(3, "log3"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(4, "log4")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := [][2]uint64{{1, 3}, {4, 4}}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("bad: %v", ranges)
+	}
+
+	// The hook failure doesn't undo the commit
+	if err := store.GetLog(4, new(raft.Log)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Failed writes don't fire the hook
+	if err := store.StoreLog(testRaftLog(4, "log4")); err == nil {
+		t.Fatalf("expected duplicate index error")
+	}
+	if len(ranges) != 2 {
+		t.Fatalf("bad: %v", ranges)
+	}
+}
+
+func TestSqlite3Store_ReadBusyTimeout(t *testing.T) {
+	fh, err := ioutil.TempFile("", "sqlite3.db")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(fh.Name())
+
+	// Use a rollback journal so that a writer blocks the readers
+	dsn := fmt.Sprintf("%s?_journal_mode=DELETE&_busy_timeout=30000", fh.Name())
+	fastStore, err := raftsqlite3.New(dsn, raftsqlite3.WithReadBusyTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer fastStore.Close()
+	slowStore, err := raftsqlite3.New(dsn, raftsqlite3.WithReadBusyTimeout(10*time.Second))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer slowStore.Close()
+	if err := fastStore.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Another process holds the database exclusively
+	db, err := sql.Open("sqlite3", fmt.Sprintf("%s?_txlock=exclusive", fh.Name()))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer tx.Rollback()
+
+	// Reads fail after the read busy timeout, not the write one
+	start := time.Now()
+	err = fastStore.GetLog(1, new(raft.Log))
+	if e, ok := err.(sqlite3.Error); !ok || e.Code != sqlite3.ErrBusy {
+		t.Fatalf("expected busy error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("read waited too long: %s", elapsed)
+	}
+
+	// Reads wait for the lock to be released within the read busy timeout
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		tx.Rollback()
+	}()
+	if err := slowStore.GetLog(1, new(raft.Log)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSqlite3Store_DataSourceName(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Defaults are merged into a plain path
+	expected := path + "?_busy_timeout=30000&_journal_mode=WAL"
+	if dsn := store.DataSourceName(); dsn != expected {
+		t.Fatalf("bad: %s", dsn)
+	}
+
+	// An explicit data source name is kept as is
+	dsn := fmt.Sprintf("%s?_journal_mode=WAL", path)
+	store2, err := raftsqlite3.New(dsn)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store2.Close()
+	if store2.DataSourceName() != dsn {
+		t.Fatalf("bad: %s", store2.DataSourceName())
+	}
+}
+
+func TestSqlite3Store_Files(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	main, wal, shm := store.Files()
+	if main != path || wal != path+"-wal" || shm != path+"-shm" {
+		t.Fatalf("bad: %s, %s, %s", main, wal, shm)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, file := range []string{main, wal, shm} {
+		if _, err := os.Stat(file); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// A file: URI
+	store2, err := raftsqlite3.New("file:" + path + "?_journal_mode=WAL")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store2.Close()
+	if main, _, _ := store2.Files(); main != path {
+		t.Fatalf("bad: %s", main)
+	}
+
+	// No files for an in-memory database
+	store3, err := raftsqlite3.New(":memory:")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store3.Close()
+	if main, wal, shm := store3.Files(); main != "" || wal != "" || shm != "" {
+		t.Fatalf("bad: %s, %s, %s", main, wal, shm)
+	}
+}
+
+func TestSqlite3Store_GetLog_DecodeError(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Store an unreadable value
+	if _, err := store.DB().Exec("insert into logs(id, value) values(1, x'c1')"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := store.GetLog(1, new(raft.Log))
+	if !errors.Is(err, raftsqlite3.ErrDecode) {
+		t.Fatalf("expected decode error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "index 1") {
+		t.Fatalf("expected the index in the error, got: %v", err)
+	}
+	_, _, err = store.GetLogRangeLimited(1, 2, 1024)
+	if !errors.Is(err, raftsqlite3.ErrDecode) || !strings.Contains(err.Error(), "index 1") {
+		t.Fatalf("expected decode error at index 1, got: %v", err)
+	}
+	err = store.IterateLogs(1, 2, func(log *raft.Log) error { return nil })
+	if !errors.Is(err, raftsqlite3.ErrDecode) || !strings.Contains(err.Error(), "index 1") {
+		t.Fatalf("expected decode error at index 1, got: %v", err)
+	}
+
+	// Absent logs are still reported as not found
+	if err := store.GetLog(2, new(raft.Log)); err != raft.ErrLogNotFound {
+		t.Fatalf("expected raft log not found error, got: %v", err)
+	}
+}
+
+func TestSqlite3Store_GetLog_EmptyValue(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	if _, err := store.DB().Exec("insert into logs(id, value) values(1, null), (2, x'')"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, idx := range []uint64{1, 2} {
+		err := store.GetLog(idx, new(raft.Log))
+		if !errors.Is(err, raftsqlite3.ErrEmptyLogValue) {
+			t.Fatalf("expected empty log value error, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), fmt.Sprintf("index %d", idx)) {
+			t.Fatalf("bad: %s", err)
+		}
+	}
+}
+
+func TestSqlite3Store_MaxValueSize_Query(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Zeros on empty log
+	idx, size, err := store.MaxValueSize()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx != 0 || size != 0 {
+		t.Fatalf("bad: %d, %d", idx, size)
+	}
+
+	logs := []*raft.Log{
+		testRaftLog(1, "log1"),
+		testRaftLog(2, strings.Repeat("x", 1024)),
+		testRaftLog(3, "log3"),
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	idx, size, err = store.MaxValueSize()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if idx != 2 || size <= 1024 {
+		t.Fatalf("bad: %d, %d", idx, size)
+	}
+}
+
+func TestSqlite3Store_VFS(t *testing.T) {
+	// A VFS built into sqlite3
+	store, path := testSqlite3Store(t, raftsqlite3.WithVFS("unix"))
+	defer store.Close()
+	defer os.Remove(path)
+	if !strings.Contains(store.DataSourceName(), "vfs=unix") {
+		t.Fatalf("bad: %s", store.DataSourceName())
+	}
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// An unregistered VFS
+	_, err := raftsqlite3.New(path, raftsqlite3.WithVFS("no-such-vfs"))
+	if !errors.Is(err, raftsqlite3.ErrVFSNotRegistered) {
+		t.Fatalf("expected vfs not registered error, got: %v", err)
+	}
+
+	// An invalid name
+	if _, err := raftsqlite3.New(path, raftsqlite3.WithVFS("unix&mode=ro")); err == nil {
+		t.Fatalf("expected invalid vfs name error")
+	}
+}
+
+func TestSqlite3Store_DeleteRangeN(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Store more logs than a delete batch
+	var logs []*raft.Log
+	for i := 1; i <= 2500; i++ {
+		logs = append(logs, testRaftLog(uint64(i), fmt.Sprintf("log%d", i)))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only the present logs are counted
+	n, err := store.DeleteRangeN(2001, 3000)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 500 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Across several batches
+	n, err = store.DeleteRangeN(1, 2000)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 2000 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// Nothing left to delete
+	n, err = store.DeleteRangeN(1, 3000)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestSqlite3Store_SplitData(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+
+	// Logs stored inline before the data was split
+	inline := testRaftLog(1, "log1")
+	if err := store.StoreLog(inline); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	store, err := raftsqlite3.New(path, raftsqlite3.WithSplitData(), raftsqlite3.WithTermColumn())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	logs := []*raft.Log{
+		&raft.Log{Index: 2, Term: 1, Data: []byte("log2")},
+		&raft.Log{Index: 3, Term: 1, Data: []byte(strings.Repeat("x", 4096))},
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The data is held apart
+	var n int
+	if err := store.DB().QueryRow("select count(*) from log_data").Scan(&n); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("bad: %d", n)
+	}
+
+	// And joined back on reads, inline logs included
+	for _, expected := range []*raft.Log{inline, logs[0], logs[1]} {
+		result := new(raft.Log)
+		if err := store.GetLog(expected.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+	result, err := store.GetLogsByTerm(1)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, logs) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Deleting logs deletes their data
+	if err := store.DeleteRange(1, 2); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DB().QueryRow("select count(*) from log_data").Scan(&n); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("bad: %d", n)
+	}
+	store.Close()
+
+	// The store can't be opened without the option anymore
+	if _, err := raftsqlite3.New(path); !errors.Is(err, raftsqlite3.ErrSchemaMismatch) {
+		t.Fatalf("expected schema mismatch error, got: %v", err)
+	}
+}
+
+func TestSqlite3Store_LagBetween(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	committed, applied := []byte("committed"), []byte("applied")
+	if _, err := store.LagBetween(committed, applied); err != raftsqlite3.ErrKeyNotFound {
+		t.Fatalf("err: %v", err)
+	}
+	if err := store.SetUint64(committed, 10); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SetUint64(applied, 7); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if lag, err := store.LagBetween(committed, applied); err != nil || lag != 3 {
+		t.Fatalf("bad: %d, %v", lag, err)
+	}
+	if lag, err := store.LagBetween(applied, committed); err != nil || lag != -3 {
+		t.Fatalf("bad: %d, %v", lag, err)
+	}
+	if lag, err := store.LagBetween(committed, committed); err != nil || lag != 0 {
+		t.Fatalf("bad: %d, %v", lag, err)
+	}
+
+	// Missing keys read as 0 with the option
+	store2, err := raftsqlite3.New(path, raftsqlite3.WithLagMissingAsZero())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store2.Close()
+	if lag, err := store2.LagBetween(committed, []byte("missing")); err != nil || lag != 10 {
+		t.Fatalf("bad: %d, %v", lag, err)
+	}
+}
+
+func TestSqlite3Store_StoreLogsIfAbsent(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	first := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}
+	second := []*raft.Log{testRaftLog(2, "other"), testRaftLog(3, "log3")}
+	for i := 0; i < 2; i++ {
+		stored, err := store.StoreLogsIfAbsent(first)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if expected := uint64(2 * (1 - i)); stored != expected {
+			t.Fatalf("bad: %d", stored)
+		}
+		stored, err = store.StoreLogsIfAbsent(second)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if expected := uint64(1 - i); stored != expected {
+			t.Fatalf("bad: %d", stored)
+		}
+	}
+
+	// The present logs aren't overwritten
+	for _, expected := range []*raft.Log{first[0], first[1], second[1]} {
+		result := new(raft.Log)
+		if err := store.GetLog(expected.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+}
+
+func TestSqlite3Store_BusyHandler(t *testing.T) {
+	fh, err := ioutil.TempFile("", "sqlite3.db")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(fh.Name())
+
+	var (
+		counts  []int
+		release func()
+	)
+	handler := func(count int) bool {
+		counts = append(counts, count)
+		if release != nil && count == 1 {
+			release()
+		}
+		return count < 3
+	}
+	var attempts []string
+	onRetry := func(op string, attempt int, err error) {
+		attempts = append(attempts, fmt.Sprintf("%s %d", op, attempt))
+	}
+	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=0", fh.Name())
+	store, err := raftsqlite3.New(dsn, raftsqlite3.WithBusyHandler(handler), raftsqlite3.WithOnRetry(onRetry))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+
+	// Another process holds the write lock
+	db, err := sql.Open("sqlite3", fmt.Sprintf("%s?_txlock=immediate", fh.Name()))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer tx.Rollback()
+
+	// The handler gives up
+	err = store.StoreLog(testRaftLog(1, "log1"))
+	if e, ok := err.(sqlite3.Error); !ok || e.Code != sqlite3.ErrBusy {
+		t.Fatalf("expected busy error, got: %v", err)
+	}
+	if !reflect.DeepEqual(counts, []int{0, 1, 2, 3}) {
+		t.Fatalf("bad: %v", counts)
+	}
+	if !reflect.DeepEqual(attempts, []string{"StoreLogs 1", "StoreLogs 2", "StoreLogs 3"}) {
+		t.Fatalf("bad: %v", attempts)
+	}
+
+	// The handler waits for the lock
+	attempts = nil
+	counts, release = nil, func() { tx.Rollback() }
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(counts, []int{0, 1}) {
+		t.Fatalf("bad: %v", counts)
+	}
+	if !reflect.DeepEqual(attempts, []string{"StoreLogs 1", "StoreLogs 2"}) {
+		t.Fatalf("bad: %v", attempts)
+	}
+	if st, err := store.Stats(); err != nil || st.BusyRetries != 5 {
+		t.Fatalf("bad: %+v, %v", st, err)
+	}
+}
+
+func TestSqlite3Store_OnRetry(t *testing.T) {
+	// A transformer failing twice, standing for a transient error
+	transient := errors.New("transient")
+	failures := 0
+	enc := func(b []byte) ([]byte, error) {
+		if failures < 2 {
+			failures++
+			return nil, transient
+		}
+		return b, nil
+	}
+	dec := func(b []byte) ([]byte, error) {
+		return b, nil
+	}
+	classifier := func(err error) bool {
+		return errors.Is(err, raftsqlite3.ErrEncode)
+	}
+	var (
+		ops      []string
+		attempts []int
+		errs     []error
+	)
+	onRetry := func(op string, attempt int, err error) {
+		ops = append(ops, op)
+		attempts = append(attempts, attempt)
+		errs = append(errs, err)
+	}
+	store, path := testSqlite3Store(t, raftsqlite3.WithValueTransformer(enc, dec),
+		raftsqlite3.WithRetryClassifier(classifier), raftsqlite3.WithOnRetry(onRetry))
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Called once per retry, before the write succeeds
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(ops, []string{"StoreLogs", "StoreLogs"}) {
+		t.Fatalf("bad: %v", ops)
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2}) {
+		t.Fatalf("bad: %v", attempts)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, raftsqlite3.ErrEncode) || !strings.Contains(err.Error(), "transient") {
+			t.Fatalf("bad: %v", err)
+		}
+	}
+
+	// Not called without retries
+	ops = nil
+	if err := store.StoreLog(testRaftLog(2, "log2")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.Set([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(ops) != 0 {
+		t.Fatalf("bad: %v", ops)
+	}
+}
+
+func TestSqlite3Store_RetryClassifier(t *testing.T) {
+	// A transformer failing twice, standing for a transient error
+	failures := 0
+	enc := func(b []byte) ([]byte, error) {
+		if failures < 2 {
+			failures++
+			return nil, errors.New("transient")
+		}
+		return b, nil
+	}
+	dec := func(b []byte) ([]byte, error) {
+		return b, nil
+	}
+	classifier := func(err error) bool {
+		return errors.Is(err, raftsqlite3.ErrEncode)
+	}
+	store, path := testSqlite3Store(t, raftsqlite3.WithValueTransformer(enc, dec),
+		raftsqlite3.WithRetryClassifier(classifier))
+	defer store.Close()
+	defer os.Remove(path)
+
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if failures != 2 {
+		t.Fatalf("bad: %d", failures)
+	}
+	if st, err := store.Stats(); err != nil || st.BusyRetries != 2 {
+		t.Fatalf("bad: %+v, %v", st, err)
+	}
+
+	// Not retried without the classifier
+	failures = 0
+	store2, path2 := testSqlite3Store(t, raftsqlite3.WithValueTransformer(enc, dec))
+	defer store2.Close()
+	defer os.Remove(path2)
+	if err := store2.StoreLog(testRaftLog(1, "log1")); !errors.Is(err, raftsqlite3.ErrEncode) {
+		t.Fatalf("expected encode error, got: %v", err)
+	}
+}
+
+func TestSqlite3Store_LogicalLogBytes(t *testing.T) {
+	for _, opts := range [][]raftsqlite3.Option{nil, {raftsqlite3.WithSplitData()}} {
+		store, path := testSqlite3Store(t, opts...)
+		defer store.Close()
+		defer os.Remove(path)
+
+		if size, err := store.LogicalLogBytes(); err != nil || size != 0 {
+			t.Fatalf("bad: %d, %v", size, err)
+		}
+		logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, strings.Repeat("x", 1000))}
+		if err := store.StoreLogs(logs); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		var expected uint64
+		row := store.DB().QueryRow("select sum(length(value)) from logs")
+		if err := row.Scan(&expected); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if len(opts) > 0 {
+			expected += 4 + 1000
+		}
+		if size, err := store.LogicalLogBytes(); err != nil || size != expected {
+			t.Fatalf("bad: %d, %v", size, err)
+		}
+		if expected < 1004 {
+			t.Fatalf("bad: %d", expected)
+		}
+	}
+}
+
+func TestSqlite3Store_WriteTimeout(t *testing.T) {
+	fh, err := ioutil.TempFile("", "sqlite3.db")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.Remove(fh.Name())
+
+	const timeout = 300 * time.Millisecond
+	dsn := fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=30000", fh.Name())
+	store, err := raftsqlite3.New(dsn, raftsqlite3.WithWriteTimeout(timeout))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if dsn := store.DataSourceName(); !strings.Contains(dsn, "_busy_timeout=300&") {
+		t.Fatalf("bad: %s", dsn)
+	}
+
+	// Another process holds the write lock
+	db, err := sql.Open("sqlite3", fmt.Sprintf("%s?_txlock=immediate", fh.Name()))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer tx.Rollback()
+
+	// The contended writes fail after the timeout, not the 30s busy timeout
+	// nor the endless retries
+	for _, write := range []func() error{
+		func() error { return store.StoreLog(testRaftLog(1, "log1")) },
+		func() error { return store.DeleteRange(1, 10) },
+	} {
+		start := time.Now()
+		err = write()
+		elapsed := time.Since(start)
+		if e, ok := err.(sqlite3.Error); !ok || e.Code != sqlite3.ErrBusy {
+			t.Fatalf("expected busy error, got: %v", err)
+		}
+		if elapsed < timeout || elapsed > 2*timeout {
+			t.Fatalf("bad: %s", elapsed)
+		}
+	}
+}
+
+func TestSqlite3Store_AppendLog(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	for _, c := range []struct {
+		idx, expected uint64
+	}{{1, 1}, {2, 2}, {5, 5}, {3, 5}} {
+		last, err := store.AppendLog(testRaftLog(c.idx, "log"))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if last != c.expected {
+			t.Fatalf("bad: %d", last)
+		}
+	}
+
+	// Nothing is stored on error
+	if _, err := store.AppendLog(testRaftLog(5, "log")); err == nil {
+		t.Fatalf("should fail on a duplicate index")
+	}
+	if last, err := store.LastIndex(); err != nil || last != 5 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+}
+
+func TestSqlite3Store_GetLogsPageWithTotal(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 5; i++ {
+		logs = append(logs, testRaftLog(i, fmt.Sprintf("log%d", i)))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for _, c := range []struct {
+		after    uint64
+		limit    int
+		expected []*raft.Log
+	}{
+		{0, 2, logs[:2]},
+		{2, 2, logs[2:4]},
+		{4, 2, logs[4:]},
+		{5, 2, nil},
+	} {
+		page, total, err := store.GetLogsPageWithTotal(c.after, c.limit)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if total != 5 {
+			t.Fatalf("bad: %d", total)
+		}
+		if !reflect.DeepEqual(page, c.expected) {
+			t.Fatalf("bad page after %d: %#v", c.after, page)
+		}
+	}
+}
+
+func TestSqlite3Store_HasLog(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	// The value isn't decoded
+	if _, err := store.DB().Exec("insert into logs(id, value) values(2, x'c1')"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for idx, expected := range map[uint64]bool{1: true, 2: true, 3: false} {
+		if ok, err := store.HasLog(idx); err != nil || ok != expected {
+			t.Fatalf("bad %d: %t, %v", idx, ok, err)
+		}
+	}
+}
+
+func TestSqlite3Store_SelfCheck(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// An empty log is fine
+	if err := store.SelfCheck(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2"), testRaftLog(3, "log3")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.SelfCheck(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// An unreadable last log
+	if _, err := store.DB().Exec("update logs set value = x'c1' where id = 3"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	err := store.SelfCheck()
+	if !errors.Is(err, raftsqlite3.ErrDecode) || !strings.Contains(err.Error(), "last index 3") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestSqlite3Store_ConnectInit(t *testing.T) {
+	script := "pragma temp_store = memory;\n PRAGMA cache_spill = off;"
+	store, path := testSqlite3Store(t, raftsqlite3.WithConnectInit(script))
+	defer store.Close()
+	defer os.Remove(path)
+
+	var tempStore, cacheSpill int
+	if err := store.DB().QueryRow("pragma temp_store").Scan(&tempStore); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.DB().QueryRow("pragma cache_spill").Scan(&cacheSpill); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if tempStore != 2 || cacheSpill != 0 {
+		t.Fatalf("bad: %d, %d", tempStore, cacheSpill)
+	}
+
+	// Only pragmas are allowed
+	for _, script := range []string{"delete from logs", "pragma", "pragma foreign_keys = on; drop table logs"} {
+		if _, err := raftsqlite3.New(path, raftsqlite3.WithConnectInit(script)); err == nil {
+			t.Fatalf("should fail on %q", script)
+		}
+	}
+}
+
+func TestSqlite3Store_IsEmpty(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	if empty, err := store.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if empty, err := store.IsEmpty(); err != nil || empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+	if err := store.DeleteRange(1, 1); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if empty, err := store.IsEmpty(); err != nil || !empty {
+		t.Fatalf("bad: %t, %v", empty, err)
+	}
+}
+
+func TestSqlite3Store_SetString_GetString(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Returns error on non-existent key
+	if _, err := store.GetString([]byte("bad")); err != raftsqlite3.ErrKeyNotFound {
+		t.Fatalf("expected not found error, got: %q", err)
+	}
+
+	for _, v := range []string{"world", ""} {
+		if err := store.SetString([]byte("hello"), v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if val, err := store.GetString([]byte("hello")); err != nil || val != v {
+			t.Fatalf("bad: %q, %v", val, err)
+		}
+	}
+}
+
+func TestSqlite3Store_SetBool_GetBool(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Returns error on non-existent key
+	if _, err := store.GetBool([]byte("bad")); err != raftsqlite3.ErrKeyNotFound {
+		t.Fatalf("expected not found error, got: %q", err)
+	}
+
+	for _, v := range []bool{true, false} {
+		if err := store.SetBool([]byte("flag"), v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if val, err := store.GetBool([]byte("flag")); err != nil || val != v {
+			t.Fatalf("bad: %t, %v", val, err)
+		}
+	}
+}
+
+func TestSqlite3Store_GrowthSince(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+
+	if _, _, err := store.GrowthSince(time.Time{}); err != raftsqlite3.ErrNotSupported {
+		t.Fatalf("expected not supported error, got: %v", err)
+	}
+	// Logs stored without the option have no time
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	store, err := raftsqlite3.New(path, raftsqlite3.WithTimestamps())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if err := store.StoreLog(testRaftLog(2, "log2")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	since := time.Now()
+	logs := []*raft.Log{testRaftLog(3, "log3"), testRaftLog(4, "log4")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var size uint64
+	row := store.DB().QueryRow("select sum(length(value)) from logs where id >= 3")
+	if err := row.Scan(&size); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	entries, bytes, err := store.GrowthSince(since)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if entries != 2 || bytes != size {
+		t.Fatalf("bad: %d, %d", entries, bytes)
+	}
+	if entries, _, err := store.GrowthSince(time.Time{}); err != nil || entries != 3 {
+		t.Fatalf("bad: %d, %v", entries, err)
+	}
+	if entries, _, err := store.GrowthSince(time.Now()); err != nil || entries != 0 {
+		t.Fatalf("bad: %d, %v", entries, err)
+	}
+}
+
+func TestSqlite3Store_EstimateTimeToFull(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithTimestamps())
+	defer store.Close()
+	defer os.Remove(path)
+
+	if _, err := store.EstimateTimeToFull(1<<30, time.Minute); err != raftsqlite3.ErrNeverFull {
+		t.Fatalf("expected never full error, got: %v", err)
+	}
+	var logs []*raft.Log
+	for i := uint64(1); i <= 100; i++ {
+		logs = append(logs, testRaftLog(i, strings.Repeat("x", 1000)))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	d, err := store.EstimateTimeToFull(1<<30, time.Minute)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	// About 100KB a minute to fill 1GB
+	if d < time.Hour || d > 30*24*time.Hour {
+		t.Fatalf("bad: %s", d)
+	}
+	if d, err := store.EstimateTimeToFull(1024, time.Minute); err != nil || d != 0 {
+		t.Fatalf("bad: %s, %v", d, err)
+	}
+}
+
+func TestSqlite3Store_GetLogsInTimeRange(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+	if _, err := store.GetLogsInTimeRange(time.Time{}, time.Time{}); err != raftsqlite3.ErrNotSupported {
+		t.Fatalf("expected not supported error, got: %v", err)
+	}
+	store.Close()
+
+	store, err := raftsqlite3.New(path, raftsqlite3.WithTimestamps())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	logs := []*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2"), testRaftLog(3, "log3")}
+	var times []time.Time
+	for _, log := range logs {
+		if err := store.StoreLog(log); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		times = append(times, time.Now())
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, c := range []struct {
+		from, to time.Time
+		expected []*raft.Log
+	}{
+		{time.Time{}, time.Time{}, logs},
+		{times[0], time.Time{}, logs[1:]},
+		{time.Time{}, times[1], logs[:2]},
+		{times[0], times[1], logs[1:2]},
+		{times[2], time.Time{}, nil},
+	} {
+		result, err := store.GetLogsInTimeRange(c.from, c.to)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(result, c.expected) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+}
+
+func TestSqlite3Store_TimeSpan(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer os.Remove(path)
+	if _, _, err := store.TimeSpan(); err != raftsqlite3.ErrNotSupported {
+		t.Fatalf("expected not supported error, got: %v", err)
+	}
+	store.Close()
+
+	store, err := raftsqlite3.New(path, raftsqlite3.WithTimestamps())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if oldest, newest, err := store.TimeSpan(); err != nil || !oldest.IsZero() || !newest.IsZero() {
+		t.Fatalf("bad: %s, %s, %v", oldest, newest, err)
+	}
+
+	before := time.Now()
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := store.StoreLog(testRaftLog(2, "log2")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	after := time.Now()
+
+	oldest, newest, err := store.TimeSpan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if oldest.Before(before) || newest.After(after) || newest.Sub(oldest) < 10*time.Millisecond {
+		t.Fatalf("bad: %s, %s", oldest, newest)
+	}
+}
+
+func TestSqlite3Store_SharedCache(t *testing.T) {
+	var stores []*raftsqlite3.Sqlite3Store
+	for i := 0; i < 2; i++ {
+		store, path := testSqlite3Store(t, raftsqlite3.WithSharedCache())
+		defer store.Close()
+		defer os.Remove(path)
+		dsn := store.DataSourceName()
+		if !strings.HasPrefix(dsn, "file:") || !strings.Contains(dsn, "cache=shared") {
+			t.Fatalf("bad: %s", dsn)
+		}
+		if main, _, _ := store.Files(); main != path {
+			t.Fatalf("bad: %s", main)
+		}
+		stores = append(stores, store)
+	}
+
+	// The stores are independent
+	for i, store := range stores {
+		if err := store.StoreLog(testRaftLog(uint64(i+1), "log")); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := store.SetUint64([]byte("store"), uint64(i)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	for i, store := range stores {
+		first, err := store.FirstIndex()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		last, err := store.LastIndex()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if first != uint64(i+1) || last != first {
+			t.Fatalf("bad: %d, %d", first, last)
+		}
+		if v, err := store.GetUint64([]byte("store")); err != nil || v != uint64(i) {
+			t.Fatalf("bad: %d, %v", v, err)
+		}
+	}
+}
+
+func TestSqlite3Store_PresentRanges(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	ranges, err := store.PresentRanges()
+	if err != nil || ranges != nil {
+		t.Fatalf("bad: %v, %v", ranges, err)
+	}
+
+	var logs []*raft.Log
+	for _, idx := range []uint64{1, 2, 3, 5, 8, 9, 10, 20} {
+		logs = append(logs, testRaftLog(idx, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	ranges, err = store.PresentRanges()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := [][2]uint64{{1, 3}, {5, 5}, {8, 10}, {20, 20}}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Fatalf("bad: %v", ranges)
+	}
+}
+
+func TestSqlite3Store_LogKeyType(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithLogKeyType("text"), raftsqlite3.WithSplitData())
+	defer os.Remove(path)
+	ref, refPath := testSqlite3Store(t, raftsqlite3.WithSplitData())
+	defer ref.Close()
+	defer os.Remove(refPath)
+
+	var logs []*raft.Log
+	for _, idx := range []uint64{2, 9, 10, 11} {
+		logs = append(logs, testRaftLog(idx, fmt.Sprintf("log%d", idx)))
+	}
+	for _, s := range []*raftsqlite3.Sqlite3Store{store, ref} {
+		if err := s.StoreLogs(logs); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// The keys are zero-padded text
+	var id string
+	if err := store.DB().QueryRow("select id from logs order by id desc limit 1").Scan(&id); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if id != "00000000000000000011" {
+		t.Fatalf("bad: %s", id)
+	}
+	if first, err := store.FirstIndex(); err != nil || first != 2 {
+		t.Fatalf("bad: %d, %v", first, err)
+	}
+	if last, err := store.LastIndex(); err != nil || last != 11 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+	for _, expected := range logs {
+		result := new(raft.Log)
+		if err := store.GetLog(expected.Index, result); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+
+	// Ranges select the same logs as with integer keys
+	for _, s := range []*raftsqlite3.Sqlite3Store{store, ref} {
+		if err := s.DeleteRange(9, 10); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	sum, err := store.RangeChecksum(0, 100)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if refSum, err := ref.RangeChecksum(0, 100); err != nil || sum != refSum {
+		t.Fatalf("bad: %d, %d, %v", sum, refSum, err)
+	}
+	store.Close()
+
+	// The store can't be reopened with another key type
+	if _, err := raftsqlite3.New(path, raftsqlite3.WithSplitData()); !errors.Is(err, raftsqlite3.ErrSchemaMismatch) {
+		t.Fatalf("expected schema mismatch error, got: %v", err)
+	}
+	ref.Close()
+	if _, err := raftsqlite3.New(refPath, raftsqlite3.WithLogKeyType("text"), raftsqlite3.WithSplitData()); !errors.Is(err, raftsqlite3.ErrSchemaMismatch) {
+		t.Fatalf("expected schema mismatch error, got: %v", err)
+	}
+	if _, err := raftsqlite3.New(refPath, raftsqlite3.WithLogKeyType("real")); err == nil {
+		t.Fatalf("expected invalid key type error")
+	}
+}
+
+func TestSqlite3Store_Immutable(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Checkpointed logs, then logs in the WAL of the writer
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.TruncateWAL(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(3, "log3")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ro, err := raftsqlite3.New(path, raftsqlite3.WithImmutable())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer ro.Close()
+	if main, _, _ := ro.Files(); main != path {
+		t.Fatalf("bad: %s", main)
+	}
+	if last, err := ro.LastIndex(); err != nil || last != 2 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+	result := new(raft.Log)
+	if err := ro.GetLog(2, result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, testRaftLog(2, "log2")) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if err := ro.StoreLog(testRaftLog(4, "log4")); err == nil {
+		t.Fatalf("should fail to write")
+	}
+
+	// The writer goes on
+	if err := store.StoreLog(testRaftLog(4, "log4")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSqlite3Store_IgnoreWAL(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	// Checkpointed logs, then logs in the WAL
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.TruncateWAL(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := store.StoreLog(testRaftLog(3, "log3")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A copy of the files before the next checkpoint
+	cp := path + ".copy"
+	defer os.Remove(cp)
+	defer os.Remove(cp + "-wal")
+	defer os.Remove(cp + "-shm")
+	for _, suffix := range []string{"", "-wal"} {
+		b, err := ioutil.ReadFile(path + suffix)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(cp+suffix, b, 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	wal, err := ioutil.ReadFile(cp + "-wal")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The frames of the WAL aren't applied
+	before, err := raftsqlite3.New(cp, raftsqlite3.WithIgnoreWAL())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if last, err := before.LastIndex(); err != nil || last != 2 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+	if err := before.GetLog(3, new(raft.Log)); err != raft.ErrLogNotFound {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	before.Close()
+	if b, err := ioutil.ReadFile(cp + "-wal"); err != nil || !bytes.Equal(b, wal) {
+		t.Fatalf("bad: WAL changed, %v", err)
+	}
+
+	// The WAL is left for the next open
+	after, err := raftsqlite3.New(cp)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer after.Close()
+	result := new(raft.Log)
+	if err := after.GetLog(3, result); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, testRaftLog(3, "log3")) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestSqlite3Store_DeleteYield(t *testing.T) {
+	const yield = 50 * time.Millisecond
+	store, path := testSqlite3Store(t, raftsqlite3.WithDeleteYield(yield))
+	defer store.Close()
+	defer os.Remove(path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 2500; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Three batches, two pauses
+	start := time.Now()
+	n, err := store.DeleteRangeN(1, 2500)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if n != 2500 {
+		t.Fatalf("bad: %d", n)
+	}
+	if elapsed := time.Since(start); elapsed < 2*yield {
+		t.Fatalf("bad: %s", elapsed)
+	}
+}
+
+func TestSqlite3Store_IsLocked(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	if locked, err := store.IsLocked(); err != nil || locked {
+		t.Fatalf("bad: %t, %v", locked, err)
+	}
+
+	// Another process holds the write lock
+	db, err := sql.Open("sqlite3", fmt.Sprintf("%s?_txlock=immediate", path))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	start := time.Now()
+	if locked, err := store.IsLocked(); err != nil || !locked {
+		t.Fatalf("bad: %t, %v", locked, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("waited too long: %s", elapsed)
+	}
+	tx.Rollback()
+
+	// The check doesn't hold the lock
+	if locked, err := store.IsLocked(); err != nil || locked {
+		t.Fatalf("bad: %t, %v", locked, err)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestSqlite3Store_PageSize(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithPageSize(8192))
+	defer os.Remove(path)
+
+	var (
+		size int
+		mode string
+	)
+	if err := store.DB().QueryRow("pragma page_size").Scan(&size); err != nil || size != 8192 {
+		t.Fatalf("bad: %d, %v", size, err)
+	}
+	if err := store.DB().QueryRow("pragma journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("bad: %s, %v", mode, err)
+	}
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	if _, err := raftsqlite3.New(path, raftsqlite3.WithPageSize(4096)); !errors.Is(err, raftsqlite3.ErrSchemaMismatch) {
+		t.Fatalf("expected schema mismatch error, got: %v", err)
+	}
+	store, err := raftsqlite3.New(path, raftsqlite3.WithPageSize(8192))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	store.Close()
+
+	if _, err := raftsqlite3.New(path, raftsqlite3.WithPageSize(1000)); err == nil {
+		t.Fatalf("expected invalid page size error")
+	}
+}
+
+func TestSqlite3Store_WriteRateLimit(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithWriteRateLimit(200<<10))
+	defer store.Close()
+	defer os.Remove(path)
+
+	// 400KB at 200KB/s, past a burst of 200KB
+	data := strings.Repeat("x", 40<<10)
+	start := time.Now()
+	for i := uint64(1); i <= 10; i++ {
+		if err := store.StoreLog(testRaftLog(i, data)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Fatalf("bad: %s", elapsed)
+	}
+	if last, err := store.LastIndex(); err != nil || last != 10 {
+		t.Fatalf("bad: %d, %v", last, err)
+	}
+}
@@ -0,0 +1,90 @@
+package raftsqlite3
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the store for monitoring.
+type Stats struct {
+	// LogCount is the number of logs, FirstIndex and LastIndex their range.
+	LogCount   uint64
+	FirstIndex uint64
+	LastIndex  uint64
+	// DBSize and WALSize are the sizes in bytes of the database and its WAL
+	// file, zero when the file is missing or the database is in memory.
+	DBSize  int64
+	WALSize int64
+	// BusyRetries counts the writes retried on a busy database since open.
+	BusyRetries uint64
+	// ReadsInFlight is the number of reads running, see
+	// WithMaxConcurrentReads.
+	ReadsInFlight int64
+}
+
+// Stats returns a snapshot of the log and file sizes of the store.
+func (s *Sqlite3Store) Stats() (Stats, error) {
+	var st Stats
+	// A log at index 0 reads as an empty log, like with FirstIndex
+	query := fmt.Sprintf("select count(*), coalesce(min(id), 0), coalesce(max(id), 0) from %s where id >= ?", dbLogs)
+	ctx, cancel := s.opContext()
+	defer cancel()
+	row := s.reader().QueryRowContext(ctx, query, s.logKey(1))
+	if err := row.Scan(&st.LogCount, &st.FirstIndex, &st.LastIndex); err != nil {
+		return Stats{}, timeoutError(ctx, err)
+	}
+	main, wal, _ := s.Files()
+	if main != "" {
+		var err error
+		if st.DBSize, err = fileSize(main); err != nil {
+			return Stats{}, err
+		}
+		if st.WALSize, err = fileSize(wal); err != nil {
+			return Stats{}, err
+		}
+	}
+	st.BusyRetries = atomic.LoadUint64(&s.busyRetries)
+	st.ReadsInFlight = atomic.LoadInt64(&s.readsInFlight)
+	return st, nil
+}
+
+// fileSize returns the size of the file at path, zero if it doesn't exist.
+func fileSize(path string) (int64, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// diagnosticPragmas are the pragmas whose values Pragmas returns.
+var diagnosticPragmas = []string{
+	"journal_mode", "synchronous", "busy_timeout", "cache_size",
+	"page_size", "wal_autocheckpoint", "auto_vacuum", "query_only",
+}
+
+// Pragmas returns the effective values of the pragmas configuring the store,
+// as read on a single connection of the writer, for diagnostics.
+func (s *Sqlite3Store) Pragmas() (map[string]string, error) {
+	conn, err := s.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	values := make(map[string]string, len(diagnosticPragmas))
+	for _, name := range diagnosticPragmas {
+		var val string
+		query := fmt.Sprintf("pragma %s", name)
+		if err := conn.QueryRowContext(context.Background(), query).Scan(&val); err != nil {
+			return nil, fmt.Errorf("pragma %s: %w", name, err)
+		}
+		values[name] = val
+	}
+	return values, nil
+}
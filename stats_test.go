@@ -0,0 +1,168 @@
+package raftsqlite3
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_Stats(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	st, err := store.Stats()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if st.LogCount != 0 || st.FirstIndex != 0 || st.LastIndex != 0 || st.BusyRetries != 0 {
+		t.Fatalf("bad: %+v", st)
+	}
+	if st.DBSize <= 0 {
+		t.Fatalf("bad: %+v", st)
+	}
+
+	logs := []*raft.Log{testRaftLog(3, "log3"), testRaftLog(4, "log4"), testRaftLog(5, "log5")}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if st, err = store.Stats(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if st.LogCount != 3 || st.FirstIndex != 3 || st.LastIndex != 5 {
+		t.Fatalf("bad: %+v", st)
+	}
+	wal, err := os.Stat(path + "-wal")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if st.WALSize != wal.Size() || st.WALSize == 0 {
+		t.Fatalf("bad: %+v", st)
+	}
+}
+
+func TestSqlite3Store_Pragmas(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithWALAutoCheckpoint(500),
+		raftsqlite3.WithCommitMode(raftsqlite3.CommitImmediate))
+	defer store.Close()
+	defer os.Remove(path)
+
+	pragmas, err := store.Pragmas()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(pragmas) != 8 {
+		t.Fatalf("bad: %v", pragmas)
+	}
+	expected := map[string]string{
+		"journal_mode":       "wal",
+		"synchronous":        "2",
+		"wal_autocheckpoint": "500",
+		"query_only":         "0",
+	}
+	for name, val := range expected {
+		if pragmas[name] != val {
+			t.Fatalf("bad %s: %v", name, pragmas)
+		}
+	}
+}
+
+// blockingStore blocks GetLog until released.
+type blockingStore struct {
+	*raft.InmemStore
+	entered, release chan struct{}
+}
+
+func (s *blockingStore) GetLog(idx uint64, log *raft.Log) error {
+	s.entered <- struct{}{}
+	<-s.release
+	return s.InmemStore.GetLog(idx, log)
+}
+
+func TestSqlite3Store_MaxConcurrentReads(t *testing.T) {
+	fb := &blockingStore{raft.NewInmemStore(), make(chan struct{}), make(chan struct{})}
+	store, path := testSqlite3Store(t, raftsqlite3.WithMaxConcurrentReads(1),
+		raftsqlite3.WithReadFallback(fb))
+	defer store.Close()
+	defer os.Remove(path)
+	if err := store.StoreLog(testRaftLog(1, "log1")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A read missing the log holds the slot in the fallback
+	done := make(chan error, 2)
+	go func() {
+		done <- store.GetLog(2, new(raft.Log))
+	}()
+	<-fb.entered
+	st, err := store.Stats()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if st.ReadsInFlight != 1 {
+		t.Fatalf("bad: %+v", st)
+	}
+
+	// The next read queues
+	go func() {
+		done <- store.GetLog(1, new(raft.Log))
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("should queue, got: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(fb.release)
+	if err := <-done; err != raft.ErrLogNotFound {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if st, err = store.Stats(); err != nil || st.ReadsInFlight != 0 {
+		t.Fatalf("bad: %+v, %v", st, err)
+	}
+}
+
+func TestSqlite3Store_MaxConcurrentReads_Cursor(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithMaxConcurrentReads(1))
+	defer store.Close()
+	defer os.Remove(path)
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The cursor holds the slot while the callbacks run
+	done := make(chan error, 1)
+	err := store.IterateLogs(1, 2, func(log *raft.Log) error {
+		st, err := store.Stats()
+		if err != nil {
+			return err
+		}
+		if st.ReadsInFlight != 1 {
+			t.Fatalf("bad: %+v", st)
+		}
+		if log.Index == 1 {
+			go func() {
+				_, err := store.HasLog(1)
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				t.Fatalf("should queue, got: %v", err)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
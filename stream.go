@@ -0,0 +1,83 @@
+package raftsqlite3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+)
+
+// StreamLogs sends the logs within the given range inclusively on the
+// returned log channel in index order, reading them with a cursor. Both
+// channels are closed once the logs are sent, after sending an error on the
+// error channel if the read fails. Cancel ctx to stop early, which sends
+// ctx.Err(); a consumer that stops receiving must do so.
+func (s *Sqlite3Store) StreamLogs(ctx context.Context, min, max uint64) (<-chan *raft.Log, <-chan error) {
+	logCh, errCh := make(chan *raft.Log), make(chan error, 1)
+	go func() {
+		defer close(logCh)
+		defer close(errCh)
+
+		cond := "where id >= ? and id <= ? order by id asc"
+		err := s.eachLog(ctx, cond, []interface{}{s.logKey(min), s.logKey(max)}, func(log *raft.Log) error {
+			select {
+			case logCh <- log:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errCh <- err
+		}
+	}()
+	return logCh, errCh
+}
+
+// eachLog calls fn with the logs selected by cond one at a time,
+// until fn returns an error. It holds a read slot while the cursor is open.
+func (s *Sqlite3Store) eachLog(ctx context.Context, cond string, args []interface{},
+	fn func(log *raft.Log) error) error {
+	s.beginRead()
+	defer s.endRead()
+
+	query := fmt.Sprintf("select id, %s from %s %s", s.logColumns(), s.logTables(), cond)
+	rows, err := s.reader().QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id        uint64
+			val, data []byte
+		)
+		if err := rows.Scan(&id, &val, &data); err != nil {
+			return err
+		}
+		log := new(raft.Log)
+		if err := s.decodeLog(val, data, log); err != nil {
+			return fmt.Errorf("%w at index %d: %v", ErrDecode, id, err)
+		}
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// IterateLogs calls fn with the logs within the given range inclusively in
+// index order, reading them with a cursor, until fn returns an error, which
+// is returned.
+func (s *Sqlite3Store) IterateLogs(min, max uint64, fn func(log *raft.Log) error) error {
+	cond := "where id >= ? and id <= ? order by id asc"
+	return s.eachLog(context.Background(), cond, []interface{}{s.logKey(min), s.logKey(max)}, fn)
+}
+
+// IterateLogsReverse is like IterateLogs, but in reverse index order, from
+// max down to min, e.g. to search backward from the tail of the log.
+func (s *Sqlite3Store) IterateLogsReverse(max, min uint64, fn func(log *raft.Log) error) error {
+	cond := "where id >= ? and id <= ? order by id desc"
+	return s.eachLog(context.Background(), cond, []interface{}{s.logKey(min), s.logKey(max)}, fn)
+}
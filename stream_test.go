@@ -0,0 +1,100 @@
+package raftsqlite3
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestSqlite3Store_StreamLogs(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	logCh, errCh := store.StreamLogs(context.Background(), 3, 7)
+	var result []*raft.Log
+	for log := range logCh {
+		result = append(result, log)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(result, logs[2:7]) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// Canceling stops the stream
+	ctx, cancel := context.WithCancel(context.Background())
+	logCh, errCh = store.StreamLogs(ctx, 1, 10)
+	if log := <-logCh; log.Index != 1 {
+		t.Fatalf("bad: %#v", log)
+	}
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("expected canceled error, got: %v", err)
+	}
+	if _, ok := <-logCh; ok {
+		t.Fatalf("expected closed channel")
+	}
+}
+
+func TestSqlite3Store_IterateLogsReverse(t *testing.T) {
+	store, path := testSqlite3Store(t)
+	defer store.Close()
+	defer os.Remove(path)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, testRaftLog(i, "log"))
+	}
+	if err := store.StoreLogs(logs); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var indexes []uint64
+	err := store.IterateLogsReverse(8, 3, func(log *raft.Log) error {
+		indexes = append(indexes, log.Index)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(indexes, []uint64{8, 7, 6, 5, 4, 3}) {
+		t.Fatalf("bad: %v", indexes)
+	}
+
+	// Stops at the first error
+	found := errors.New("found")
+	indexes = nil
+	err = store.IterateLogsReverse(10, 1, func(log *raft.Log) error {
+		indexes = append(indexes, log.Index)
+		if log.Index == 7 {
+			return found
+		}
+		return nil
+	})
+	if err != found || !reflect.DeepEqual(indexes, []uint64{10, 9, 8, 7}) {
+		t.Fatalf("bad: %v, %v", indexes, err)
+	}
+
+	indexes = nil
+	err = store.IterateLogs(3, 5, func(log *raft.Log) error {
+		indexes = append(indexes, log.Index)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(indexes, []uint64{3, 4, 5}) {
+		t.Fatalf("bad: %v, %v", indexes, err)
+	}
+}
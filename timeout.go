@@ -0,0 +1,24 @@
+package raftsqlite3
+
+import (
+	"context"
+	"fmt"
+)
+
+// opContext returns the context of an operation, which expires after the
+// statement timeout if any.
+func (s *Sqlite3Store) opContext() (context.Context, context.CancelFunc) {
+	if d := s.opts.statementTimeout; d > 0 {
+		return context.WithTimeout(context.Background(), d)
+	}
+	return context.Background(), func() {}
+}
+
+// timeoutError returns err wrapped into ErrStatementTimeout if ctx expired,
+// which interrupted the operation, else err as is.
+func timeoutError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%w: %v", ErrStatementTimeout, err)
+	}
+	return err
+}
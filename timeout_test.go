@@ -0,0 +1,58 @@
+package raftsqlite3
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/little-pan/raft-sqlite3"
+)
+
+func TestSqlite3Store_StatementTimeout(t *testing.T) {
+	store, path := testSqlite3Store(t, raftsqlite3.WithStatementTimeout(time.Second))
+	if err := store.StoreLogs([]*raft.Log{testRaftLog(1, "log1"), testRaftLog(2, "log2")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if logs, err := store.GetLogRange(1, 2); err != nil || len(logs) != 2 {
+		t.Fatalf("bad: %v, %v", logs, err)
+	}
+	store.Close()
+	defer os.Remove(path)
+
+	// Every statement outlasts the timeout
+	store, err := raftsqlite3.New(path, raftsqlite3.WithStatementTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer store.Close()
+	if err := store.GetLog(1, new(raft.Log)); !errors.Is(err, raftsqlite3.ErrStatementTimeout) {
+		t.Fatalf("expected statement timeout error, got: %v", err)
+	}
+	if _, err := store.GetLogRange(1, 2); !errors.Is(err, raftsqlite3.ErrStatementTimeout) {
+		t.Fatalf("expected statement timeout error, got: %v", err)
+	}
+	if err := store.Set([]byte("k"), []byte("v")); !errors.Is(err, raftsqlite3.ErrStatementTimeout) {
+		t.Fatalf("expected statement timeout error, got: %v", err)
+	}
+
+	// The other reads of the logs and of the conf are bounded too
+	for name, op := range map[string]func() error{
+		"HasLog":          func() error { _, err := store.HasLog(1); return err },
+		"IsEmpty":         func() error { _, err := store.IsEmpty(); return err },
+		"GetLogs":         func() error { _, err := store.GetLogs([]uint64{1, 2}); return err },
+		"PresentRanges":   func() error { _, err := store.PresentRanges(); return err },
+		"RangeChecksum":   func() error { _, err := store.RangeChecksum(1, 2); return err },
+		"MaxValueSize":    func() error { _, _, err := store.MaxValueSize(); return err },
+		"LogicalLogBytes": func() error { _, err := store.LogicalLogBytes(); return err },
+		"LagBetween":      func() error { _, err := store.LagBetween([]byte("a"), []byte("b")); return err },
+		"RangePrefix":     func() error { _, err := store.RangePrefix([]byte("k")); return err },
+		"Stats":           func() error { _, err := store.Stats(); return err },
+		"Diff":            func() error { _, err := store.Diff(store, 1, 2); return err },
+	} {
+		if err := op(); !errors.Is(err, raftsqlite3.ErrStatementTimeout) {
+			t.Fatalf("%s: expected statement timeout error, got: %v", name, err)
+		}
+	}
+}
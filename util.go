@@ -3,14 +3,27 @@ package raftsqlite3
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
 
 	"github.com/hashicorp/go-msgpack/codec"
 )
 
-// Decode reverses the encode operation on a byte slice input
-func decodeMsgPack(buf []byte, out interface{}) error {
+// msgpackVersion is the version of the msgpack format written by
+// encodeMsgPack, to be bumped when a change of the msgpack library changes it
+const msgpackVersion = 1
+
+// Decode reverses the encode operation on a byte slice input, written in the
+// given version of the msgpack format
+func decodeMsgPack(buf []byte, out interface{}, version int) error {
+	var hd codec.MsgpackHandle
+	switch version {
+	case 1:
+	default:
+		return fmt.Errorf("unknown msgpack format version %d", version)
+	}
 	r := bytes.NewBuffer(buf)
-	hd := codec.MsgpackHandle{}
 	dec := codec.NewDecoder(r, &hd)
 	return dec.Decode(out)
 }
@@ -35,3 +48,25 @@ func uint64ToBytes(u uint64) []byte {
 	binary.BigEndian.PutUint64(buf, u)
 	return buf
 }
+
+// Converts bytes to a bool
+func bytesToBool(b []byte) bool {
+	return len(b) > 0 && b[0] != 0
+}
+
+// Converts a bool to a byte slice
+func boolToBytes(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// Converts a time to nanoseconds since the Unix epoch, the zero time to the
+// earliest one
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return math.MinInt64
+	}
+	return t.UnixNano()
+}